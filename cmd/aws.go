@@ -3,11 +3,18 @@ package main
 import (
 	"crypto/x509"
 	"encoding/pem"
+	"fmt"
 	"io/ioutil"
 	"math/rand"
+	"regexp"
 	"strings"
 	"time"
 
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/republicprotocol/republic-go/cmd/darknode/config"
 	"github.com/republicprotocol/republic-go/crypto"
 	"github.com/urfave/cli"
 	"golang.org/x/crypto/ssh"
@@ -189,17 +196,427 @@ func parseRegionAndInstance(ctx *cli.Context) (string, string, error) {
 	}
 
 	// Parse the input instance type or use the default one.
+	if err := validateAwsInstance(region, instance); err != nil {
+		return "", "", err
+	}
+
+	return region, instance, nil
+}
+
+// validateAwsInstance checks the instance type is supported in the region.
+func validateAwsInstance(region, instance string) error {
 	if region == EuWest3 && !StringInSlice(instance, AllAwsInstancesInEuWest3) {
-		return "", "", UnSupportedInstanceType
+		return UnSupportedInstanceType
 	}
 	if region == ApNorthEast1 && !StringInSlice(instance, AllAwsInstancesInApNortheast1) {
-		return "", "", UnSupportedInstanceType
+		return UnSupportedInstanceType
 	}
 	if !StringInSlice(instance, AllAwsInstances) {
-		return "", "", UnSupportedInstanceType
+		return UnSupportedInstanceType
 	}
 
-	return region, instance, nil
+	return nil
+}
+
+func init() {
+	RegisterProvider(AwsProvider{})
+}
+
+// AwsProvider deploys Darknodes to AWS EC2 instances using terraform.
+type AwsProvider struct{}
+
+// Name implements the Provider interface.
+func (aws AwsProvider) Name() string {
+	return "aws"
+}
+
+// CredentialsFlags implements the CredentialsProvider interface.
+func (aws AwsProvider) CredentialsFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.BoolFlag{
+			Name:  "aws",
+			Usage: "AWS will be used to provision the Darknode",
+		},
+		cli.StringFlag{
+			Name:  "aws-access-key",
+			Usage: "AWS access `key` for programmatic access",
+		},
+		cli.StringFlag{
+			Name:  "aws-secret-key",
+			Usage: "AWS secret `key` for programmatic access",
+		},
+		cli.StringFlag{
+			Name:  "aws-profile",
+			Usage: "A `profile` of the shared AWS credentials and config files, instead of access keys",
+		},
+		cli.StringFlag{
+			Name:  "aws-role-arn",
+			Usage: "The `ARN` of an IAM role which is assumed with the credentials",
+		},
+		cli.StringFlag{
+			Name:  "aws-mfa-serial",
+			Usage: "The `serial` number or ARN of the MFA device required to assume the role",
+		},
+	}
+}
+
+// Flags implements the Provider interface.
+func (aws AwsProvider) Flags() []cli.Flag {
+	return append(aws.CredentialsFlags(),
+		cli.StringFlag{
+			Name:  "aws-region",
+			Usage: "An optional AWS region (default: random)",
+		},
+		cli.StringFlag{
+			Name:  "aws-instance",
+			Value: "t2.medium",
+			Usage: "An optional AWS EC2 instance type",
+		},
+		cli.StringFlag{
+			Name:  "aws-elastic-ip",
+			Usage: "An optional allocation ID for an elastic IP address",
+		},
+	)
+}
+
+// Selected implements the Provider interface.
+func (aws AwsProvider) Selected(ctx *cli.Context) bool {
+	return ctx.Bool("aws")
+}
+
+// Deploy parses the AWS credentials and use terraform to deploy the node to
+// AWS.
+func (aws AwsProvider) Deploy(ctx *cli.Context) error {
+	// Try getting AWS credentials from the profile, the input, the
+	// environment or the default shared profile.
+	auth, err := parseAwsAuth(ctx)
+	if err != nil {
+		return err
+	}
+	env, err := deployEnv(ctx, aws, func() ([]string, error) {
+		return awsEnv(auth)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Parse region and instance type
+	region, instance, err := parseRegionAndInstance(ctx)
+	if err != nil {
+		return err
+	}
+	nodeDirectory, config, pubKey, err := initNode(ctx, aws, region, instance)
+	if err != nil {
+		return err
+	}
+	if err := rememberAwsAuth(ctx.String("name"), auth); err != nil {
+		if err := cleanUp(nodeDirectory); err != nil {
+			return err
+		}
+		return err
+	}
+	if err := generateTerraformConfig(ctx, config, region, instance, pubKey, nodeDirectory); err != nil {
+		if err := cleanUp(nodeDirectory); err != nil {
+			return err
+		}
+		return err
+	}
+	if err := runTerraform(nodeDirectory, env); err != nil {
+		if err := cleanUp(nodeDirectory); err != nil {
+			return err
+		}
+		return err
+	}
+
+	return finishDeployment(ctx)
+}
+
+// Destroy implements the Provider interface.
+func (aws AwsProvider) Destroy(name string) error {
+	env, err := aws.nodeEnv(name)
+	if err != nil {
+		return err
+	}
+
+	return destroyTerraformNode(NodeDirectory(name), env)
+}
+
+// Start implements the Provider interface.
+func (aws AwsProvider) Start(name string) error {
+	return runRemoteScript(name, "sudo systemctl start darknode")
+}
+
+// Stop implements the Provider interface.
+func (aws AwsProvider) Stop(name string) error {
+	return runRemoteScript(name, "sudo systemctl stop darknode")
+}
+
+// Resize changes the EC2 instance type of the Darknode and applies the change
+// with terraform. The multiAddress is refreshed afterwards as the public IP
+// of the instance changes when it is restarted.
+func (aws AwsProvider) Resize(name, instance string) error {
+	node, err := LoadNode(name)
+	if err != nil {
+		return err
+	}
+	if err := validateAwsInstance(node.Region, instance); err != nil {
+		return err
+	}
+	env, err := aws.nodeEnv(name)
+	if err != nil {
+		return err
+	}
+	nodeDirectory := NodeDirectory(name)
+	data, err := readSecret(nodeDirectory + "/main.tf")
+	if err != nil {
+		return err
+	}
+	instanceType := regexp.MustCompile(`ec2_instance_type = ".*"`)
+	data = instanceType.ReplaceAll(data, []byte(fmt.Sprintf(`ec2_instance_type = "%v"`, instance)))
+	if err := writeSecret(nodeDirectory+"/main.tf", data); err != nil {
+		return err
+	}
+	if err := runTerraform(nodeDirectory, env); err != nil {
+		return err
+	}
+
+	return refreshMultiAddress(name)
+}
+
+// Status implements the Provider interface.
+func (aws AwsProvider) Status(name string) (string, error) {
+	return serviceStatus(name)
+}
+
+// NewProfile implements the CredentialsProvider interface. A profile either
+// refers to a profile in the shared AWS credentials and config files, or
+// contains access keys, and can assume a role with them. The secret key is
+// asked for if it is not given.
+func (aws AwsProvider) NewProfile(ctx *cli.Context) (Profile, error) {
+	auth, err := parseAwsAuth(ctx)
+	if err != nil {
+		return Profile{}, err
+	}
+	if auth.profile == "" && auth.accessKey == "" && auth.roleArn == "" {
+		return Profile{}, ErrKeyNotFound
+	}
+	if auth.accessKey != "" && auth.secretKey == "" {
+		if auth.secretKey, err = readPassphrase("AWS secret key: "); err != nil {
+			return Profile{}, err
+		}
+		if auth.secretKey == "" {
+			return Profile{}, ErrKeyNotFound
+		}
+	}
+	// Roles are only assumed when the profile is used, so MFA tokens are not
+	// asked for twice.
+	if auth.profile != "" && auth.roleArn == "" {
+		if _, err := awsEnv(auth); err != nil {
+			return Profile{}, err
+		}
+	}
+
+	return Profile{
+		AwsProfile:   auth.profile,
+		AccessKey:    auth.accessKey,
+		SecretKey:    auth.secretKey,
+		AwsRoleArn:   auth.roleArn,
+		AwsMfaSerial: auth.mfaSerial,
+	}, nil
+}
+
+// ProfileEnv implements the CredentialsProvider interface.
+func (aws AwsProvider) ProfileEnv(profile Profile) ([]string, error) {
+	return awsEnv(awsAuth{
+		accessKey: profile.AccessKey,
+		secretKey: profile.SecretKey,
+		profile:   profile.AwsProfile,
+		roleArn:   profile.AwsRoleArn,
+		mfaSerial: profile.AwsMfaSerial,
+	})
+}
+
+// nodeEnv returns the environment for running terraform for the Darknode,
+// using the profile it was deployed with, or the shared profile and the role
+// it was deployed with.
+func (aws AwsProvider) nodeEnv(name string) ([]string, error) {
+	return nodeEnv(name, aws, func() ([]string, error) {
+		node, err := LoadNode(name)
+		if err != nil {
+			return nil, err
+		}
+		return awsEnv(awsAuth{
+			profile:   node.AwsProfile,
+			roleArn:   node.AwsRoleArn,
+			mfaSerial: node.AwsMfaSerial,
+		})
+	})
+}
+
+// awsAuth contains the ways of authenticating with AWS given by the user.
+type awsAuth struct {
+	accessKey string
+	secretKey string
+	profile   string
+	roleArn   string
+	mfaSerial string
+}
+
+// parseAwsAuth parses the AWS credentials from the cli parameters.
+func parseAwsAuth(ctx *cli.Context) (awsAuth, error) {
+	auth := awsAuth{
+		accessKey: ctx.String("aws-access-key"),
+		secretKey: ctx.String("aws-secret-key"),
+		profile:   ctx.String("aws-profile"),
+		roleArn:   ctx.String("aws-role-arn"),
+		mfaSerial: ctx.String("aws-mfa-serial"),
+	}
+	if auth.profile != "" && (auth.accessKey != "" || auth.secretKey != "") {
+		return awsAuth{}, ErrAwsProfileAndKeys
+	}
+	if auth.mfaSerial != "" && auth.roleArn == "" {
+		return awsAuth{}, ErrAwsMfaWithoutRole
+	}
+
+	return auth, nil
+}
+
+// rememberAwsAuth stores the shared profile and the role used to deploy the
+// Darknode in its node.json, so the Darknode can be resized and destroyed
+// with the same account. Access keys given with --aws-access-key are stored
+// in a generated profile of the Darknode instead, never in the node.json.
+func rememberAwsAuth(name string, auth awsAuth) error {
+	if auth.profile == "" && auth.roleArn == "" && auth.accessKey == "" {
+		return nil
+	}
+	node, err := LoadNode(name)
+	if err != nil {
+		return err
+	}
+	if node.Profile != "" {
+		return nil
+	}
+	if auth.accessKey != "" {
+		node, err = saveNodeProfile(node, Profile{
+			AccessKey:    auth.accessKey,
+			SecretKey:    auth.secretKey,
+			AwsRoleArn:   auth.roleArn,
+			AwsMfaSerial: auth.mfaSerial,
+		})
+		if err != nil {
+			return err
+		}
+		return SaveNode(node)
+	}
+	node.AwsProfile, node.AwsRoleArn, node.AwsMfaSerial = auth.profile, auth.roleArn, auth.mfaSerial
+
+	return SaveNode(node)
+}
+
+// awsSession creates a session with the access keys, or else with the
+// credentials of the shared profile, the environment or the default profile.
+// Shared profiles can assume roles themselves, asking for an MFA token if
+// their config requires one.
+func awsSession(auth awsAuth) (*session.Session, error) {
+	options := session.Options{
+		// STS has a global endpoint, the region of the Darknode is passed to
+		// terraform separately.
+		Config:                  awssdk.Config{Region: awssdk.String(UsEast1)},
+		Profile:                 auth.profile,
+		SharedConfigState:       session.SharedConfigEnable,
+		AssumeRoleTokenProvider: stscreds.StdinTokenProvider,
+	}
+	if auth.accessKey != "" || auth.secretKey != "" {
+		options.Config.Credentials = credentials.NewStaticCredentials(auth.accessKey, auth.secretKey, "")
+	}
+	sess, err := session.NewSessionWithOptions(options)
+	if err != nil && auth.profile != "" {
+		return nil, fmt.Errorf("%scannot read the AWS profile %q: %v%s", RED, auth.profile, err, RESET)
+	}
+
+	return sess, err
+}
+
+// awsEnv returns the environment which passes the AWS credentials to
+// terraform. If a role is given, it is assumed through STS and the temporary
+// credentials of the role are passed with their session token. Credentials
+// are never written into the terraform config.
+func awsEnv(auth awsAuth) ([]string, error) {
+	sess, err := awsSession(auth)
+	if err != nil {
+		return nil, err
+	}
+	creds := sess.Config.Credentials
+	if auth.roleArn != "" {
+		creds = stscreds.NewCredentials(sess, auth.roleArn, func(provider *stscreds.AssumeRoleProvider) {
+			// Deploying a Darknode takes longer than the default 15 minutes.
+			provider.Duration = time.Hour
+			if auth.mfaSerial != "" {
+				provider.SerialNumber = awssdk.String(auth.mfaSerial)
+				provider.TokenProvider = stscreds.StdinTokenProvider
+			}
+		})
+	}
+	credValue, err := creds.Get()
+	switch {
+	case err != nil && auth.roleArn != "":
+		return nil, fmt.Errorf("%scannot assume the role %v: %v%s", RED, auth.roleArn, err, RESET)
+	case err != nil && auth.profile != "":
+		return nil, fmt.Errorf("%scannot read the AWS profile %q: %v%s", RED, auth.profile, err, RESET)
+	case err != nil, credValue.AccessKeyID == "", credValue.SecretAccessKey == "":
+		return nil, ErrKeyNotFound
+	}
+
+	return []string{
+		"AWS_ACCESS_KEY_ID=" + credValue.AccessKeyID,
+		"AWS_SECRET_ACCESS_KEY=" + credValue.SecretAccessKey,
+		"AWS_SESSION_TOKEN=" + credValue.SessionToken,
+	}, nil
+}
+
+func generateTerraformConfig(ctx *cli.Context, config config.Config, region, instance, pubKey, nodeDirectory string) error {
+	hostKey, err := newHostKey(nodeDirectory)
+	if err != nil {
+		return err
+	}
+	allocationID := ctx.String("aws-elastic-ip")
+
+	allocationConfig, tfFolder := "", "std"
+	if allocationID != "" {
+		allocationConfig = fmt.Sprintf(`allocation_id = "%v"`, allocationID)
+		tfFolder = "eip"
+	}
+
+	terraformConfig := fmt.Sprintf(`
+variable "ssh_public_key" {
+	default = "%v"
+}
+
+variable "ssh_private_key_location" {
+	default = "%v"
+}
+	`, strings.TrimSpace(pubKey), nodeDirectory+"/ssh_keypair")
+
+	avz := region + AvailableZones[region][rand.Intn(len(AvailableZones[region]))]
+	mode := fmt.Sprintf(`
+module "node-%v" {
+    source = "%v/instance/%v"
+    ami = "%v"
+    region = "%v"
+    avz = "%v"
+    id = "%v"
+    ec2_instance_type = "%v"
+    ssh_public_key = "${var.ssh_public_key}"
+    ssh_private_key_location = "${var.ssh_private_key_location}"
+    config = "%v/config.json"
+    port = "%v"
+    path = "%v"
+    user_data = "${file("%v/user_data.yml")}"
+    host_key = "%v"
+    %v
+}`, config.Address, Directory, tfFolder, AMIs[region], region, avz, config.Address, instance, nodeDirectory, config.Port, Directory, nodeDirectory, hostKey, allocationConfig)
+
+	return ioutil.WriteFile(nodeDirectory+"/main.tf", []byte(terraformConfig+mode), 0600)
 }
 
 // NewSshKeyPair generate a new ssh key pair and writes the keys into files.
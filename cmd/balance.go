@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/republicprotocol/republic-go/contract"
+	"github.com/republicprotocol/republic-go/dispatch"
+	"github.com/urfave/cli"
+)
+
+// nodeBalance is the on-chain state of a Darknode shown by the balance
+// command. Amounts are nil if they cannot be read.
+type nodeBalance struct {
+	Name         string
+	Bond         *big.Int
+	Owner        string
+	Registration string
+	Pod          string
+	Fees         *big.Int
+}
+
+// balanceNodes prints the bond, owner, registration, pod and pending fees of
+// the Darknodes selected by name or by tags, followed by the totals of the
+// fleet.
+func balanceNodes(ctx *cli.Context) error {
+	nodes, err := selectNodesByNameOrTags(ctx.String("name"), ctx.StringSlice("tag"))
+	if err != nil {
+		return err
+	}
+	if len(nodes) == 0 {
+		return fmt.Errorf("%scannot find any node%s", RED, RESET)
+	}
+
+	registries := newRegistryConnections()
+	balances := make([]nodeBalance, len(nodes))
+	dispatch.CoForAll(nodes, func(i int) {
+		balances[i] = queryBalance(nodes[i].Name, registries.Connect(nodes[i].Name))
+	})
+
+	return writeBalances(balances)
+}
+
+// queryBalance reads the on-chain state of the Darknode. Values which cannot
+// be read are left unknown.
+func queryBalance(name string, registry Registry) nodeBalance {
+	balance := nodeBalance{
+		Name:         name,
+		Owner:        Unknown,
+		Registration: Unknown,
+		Pod:          Unknown,
+	}
+	cfg, err := loadConfig(name)
+	if err != nil || registry == nil {
+		return balance
+	}
+	darknodeID := cfg.Address.ID()
+
+	if bond, err := registry.GetBond(darknodeID); err == nil {
+		balance.Bond = bond.ToBigInt()
+	}
+	if owner, err := registry.GetOwner(darknodeID); err == nil {
+		balance.Owner = owner.Hex()
+	}
+	if fees, err := registry.PendingFees(darknodeID); err == nil {
+		balance.Fees = fees
+	}
+	if registered, err := registry.IsRegistered(cfg.Address); err == nil {
+		balance.Registration = "unregistered"
+		if registered {
+			balance.Registration = "registered"
+		} else if deregistered, err := registry.IsDeregistered(darknodeID); err == nil && deregistered {
+			balance.Registration = "deregistered"
+		}
+	}
+	switch pod, err := registry.Pod(cfg.Address); err {
+	case nil:
+		balance.Pod = fmt.Sprintf("%d", pod.Position)
+	case contract.ErrPodNotFound:
+		balance.Pod = "-"
+	}
+
+	return balance
+}
+
+// writeBalances prints the balances as a table, followed by the total bond,
+// the total pending fees and the number of registered Darknodes.
+func writeBalances(balances []nodeBalance) error {
+	table := [][]string{{"name", "bond (REN)", "fees (ETH)", "registration", "pod", "owner"}}
+	totalBond, totalFees := new(big.Int), new(big.Int)
+	registered, unknown := 0, 0
+	for _, balance := range balances {
+		table = append(table, []string{
+			balance.Name,
+			formatBalance(balance.Bond),
+			formatBalance(balance.Fees),
+			balance.Registration,
+			balance.Pod,
+			balance.Owner,
+		})
+		if balance.Bond == nil || balance.Fees == nil {
+			unknown++
+		}
+		if balance.Bond != nil {
+			totalBond.Add(totalBond, balance.Bond)
+		}
+		if balance.Fees != nil {
+			totalFees.Add(totalFees, balance.Fees)
+		}
+		if balance.Registration == "registered" {
+			registered++
+		}
+	}
+	if err := printTable(os.Stdout, table); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Printf("Total bond:         %v REN\n", formatAmount(totalBond))
+	fmt.Printf("Total pending fees: %v ETH\n", formatAmount(totalFees))
+	fmt.Printf("Registered:         %d of %d Darknodes\n", registered, len(balances))
+	if unknown > 0 {
+		fmt.Printf("%sThe balances of %d Darknodes cannot be read and are not included in the totals.%s\n", RED, unknown, RESET)
+	}
+
+	return nil
+}
+
+// formatBalance formats the amount, or returns Unknown if it cannot be read.
+func formatBalance(value *big.Int) string {
+	if value == nil {
+		return Unknown
+	}
+
+	return formatAmount(value)
+}
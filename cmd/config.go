@@ -1,12 +1,13 @@
 package main
 
 import (
-	"io/ioutil"
-	"log"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
 
 	"github.com/republicprotocol/republic-go/cmd/darknode/config"
-	"github.com/republicprotocol/republic-go/contract"
 	"github.com/republicprotocol/republic-go/crypto"
+	"github.com/republicprotocol/republic-go/dispatch"
 	"github.com/republicprotocol/republic-go/identity"
 	"github.com/republicprotocol/republic-go/logger"
 	"github.com/urfave/cli"
@@ -15,39 +16,60 @@ import (
 // GetConfigOrGenerateNew will generate a new config for the darknode.
 func GetConfigOrGenerateNew(ctx *cli.Context) (config.Config, error) {
 	keystoreFile := ctx.String("keystore")
-	passphrase := ctx.String("passphrase")
 	configFile := ctx.String("config")
 	network := ctx.String("network")
+	address := identity.Address(ctx.String("address"))
 
-	if network != "testnet" && network != "falcon" && network != "nightly" {
-		log.Println("network", network)
-		return config.Config{}, ErrUnknownNetwork
+	definition, err := LoadNetwork(network)
+	if err != nil {
+		return config.Config{}, err
 	}
-	// Parse the keystore or create a new random one.
+	bootstrapNodes, err := definition.BootstrapNodes()
+	if err != nil {
+		return config.Config{}, err
+	}
+
+	// Parse the config if one is given
+	var cfg config.Config
+	if configFile != "" {
+		cfg, err = config.NewConfigFromJSONFile(configFile)
+		if err != nil {
+			return config.Config{}, err
+		}
+	}
+
+	// Parse the keystore or create a new random one. An imported keystore
+	// must match the address of the given config.
 	var keystore crypto.Keystore
-	var err error
-	if keystoreFile == "" {
-		keystore, err = crypto.RandomKeystore()
+	switch {
+	case keystoreFile != "":
+		passphrase, err := flagPassphrase(ctx)
 		if err != nil {
 			return config.Config{}, err
 		}
-	} else {
-		data, err := ioutil.ReadFile(configFile)
+		keystore, err = importKeystore(keystoreFile, passphrase, address)
 		if err != nil {
 			return config.Config{}, err
 		}
-		if err := keystore.DecryptFromJSON(data, passphrase); err != nil {
+		if configFile != "" && cfg.Address != identity.Address(keystore.Address()) {
+			return config.Config{}, fmt.Errorf("%sthe keystore has the address %v, but the config has the address %v%s", RED, keystore.Address(), cfg.Address, RESET)
+		}
+	case configFile != "":
+		return cfg, nil
+	default:
+		keystore, err = crypto.RandomKeystore()
+		if err != nil {
 			return config.Config{}, err
 		}
 	}
 
-	// Parse the config or create a new random one
-	var cfg config.Config
-	if configFile == "" {
+	if configFile != "" {
+		cfg.Keystore = keystore
+	} else {
 		cfg = config.Config{
 			Keystore: keystore,
 			Host:     "0.0.0.0",
-			Port:     "18514",
+			Port:     definition.Port,
 			Address:  identity.Address(keystore.Address()),
 			Logs: logger.Options{
 				Plugins: []logger.PluginOptions{
@@ -58,46 +80,314 @@ func GetConfigOrGenerateNew(ctx *cli.Context) (config.Config, error) {
 					},
 				},
 			},
-			BootstrapMultiAddresses: BootstrapNodes(network),
-			Ethereum: contract.Config{
-				Network: contract.Network(network),
-			},
+			BootstrapMultiAddresses: bootstrapNodes,
+			Ethereum:                definition.Ethereum,
 		}
-	} else {
-		cfg, err = config.NewConfigFromJSONFile(configFile)
+	}
+
+	return cfg, nil
+}
+
+// saveConfig writes the config of the Darknode to its directory.
+func saveConfig(name string, cfg config.Config) error {
+	data, err := json.MarshalIndent(cfg, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return writeSecret(NodeDirectory(name)+"/config.json", data)
+}
+
+// pushConfig uploads the local config of the Darknode to the Darknode. The
+// config is decoded and validated locally like an edited config, and its
+// address must still be the address of the Darknode. It is uploaded with the
+// scp protocol to a temporary file readable only by the owner, checked to be
+// complete by comparing its sha256 with the local config, parsed again on the
+// Darknode, and then renamed over the current config so the Darknode never
+// sees a partial config. The previous config is kept as config.json.bak for
+// `darknode config rollback`.
+func pushConfig(client *SSHClient, name string) error {
+	data, err := readSecret(NodeDirectory(name) + "/config.json")
+	if err != nil {
+		return err
+	}
+	cfg, err := checkPushedConfig(name, data)
+	if err != nil {
+		return err
+	}
+	// scp only sets the permissions of new files, so a stale temporary file
+	// is removed first.
+	if err := client.Run("rm -f $HOME/.darknode/config.json.new"); err != nil {
+		return err
+	}
+	if err := client.UploadBytes(data, ".darknode/config.json.new", 0600); err != nil {
+		return err
+	}
+	script := fmt.Sprintf(`
+cd $HOME/.darknode
+if ! echo '%x  config.json.new' | sha256sum --check --status; then
+	rm -f config.json.new
+	echo "the uploaded config is incomplete" >&2
+	exit 1
+fi
+CHECK=$(mktemp -d)
+trap 'rm -rf "$CHECK"' EXIT
+cat > "$CHECK/check.go" <<'EOF'
+%s
+EOF
+if ! go run "$CHECK/check.go" config.json.new %s; then
+	rm -f config.json.new
+	echo "the uploaded config cannot be parsed" >&2
+	exit 1
+fi
+if [ -f config.json ]; then
+	cp -p config.json config.json.bak
+fi
+mv -f config.json.new config.json
+`, sha256.Sum256(data), remoteConfigCheck, shellQuote(string(cfg.Address)))
+	if err := client.Run(script); err != nil {
+		return err
+	}
+	fmt.Printf("%sConfig of [%s] has been updated to the local version.%s\n", GREEN, name, RESET)
+
+	return nil
+}
+
+// checkPushedConfig decodes and validates the local config before it is
+// pushed to the Darknode with the given name. The address of the config must
+// be the address the Darknode has been deployed with.
+func checkPushedConfig(name string, data []byte) (config.Config, error) {
+	document, err := decodeConfigDocument(data)
+	if err != nil {
+		return config.Config{}, fmt.Errorf("%sthe local config of [%s] is not valid JSON: %v%s", RED, name, err, RESET)
+	}
+	cfg, err := decodeConfig(document)
+	if err != nil {
+		return config.Config{}, fmt.Errorf("%sthe local config of [%s] is invalid: %v%s", RED, name, err, RESET)
+	}
+	original := cfg
+	node, err := LoadNode(name)
+	if err != nil {
+		return config.Config{}, err
+	}
+	if address, err := node.Address(); err == nil {
+		original.Address = identity.Address(address)
+	}
+	if err := validateConfig(cfg, original); err != nil {
+		return config.Config{}, err
+	}
+
+	return cfg, nil
+}
+
+// remoteConfigCheck is a Go program run on the Darknode, which has Go
+// installed by the up script, to parse the uploaded config before it replaces
+// the current config. It checks the config is a JSON object with the fields of
+// a Darknode config and the expected address.
+const remoteConfigCheck = `package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+func main() {
+	file, err := os.Open(os.Args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	cfg := map[string]json.RawMessage{}
+	if err := json.NewDecoder(file).Decode(&cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for _, key := range []string{"keystore", "ethereum", "address", "host", "port"} {
+		if _, ok := cfg[key]; !ok {
+			fmt.Fprintf(os.Stderr, "%s is missing\n", key)
+			os.Exit(1)
+		}
+	}
+	var address string
+	if err := json.Unmarshal(cfg["address"], &address); err != nil || address != os.Args[2] {
+		fmt.Fprintln(os.Stderr, "the address has changed")
+		os.Exit(1)
+	}
+}`
+
+// rollbackConfig restores the config which the Darknode had before the last
+// push, and restarts the Darknode. The local config is not changed.
+func rollbackConfig(ctx *cli.Context) error {
+	name := ctx.String("name")
+	if name == "" {
+		cli.ShowCommandHelp(ctx, "rollback")
+		return ErrEmptyNodeName
+	}
+	client, err := DialNode(name)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	script := `
+cd $HOME/.darknode
+if [ ! -f config.json.bak ]; then
+	echo "there is no previous config to roll back to" >&2
+	exit 1
+fi
+cp -p config.json.bak config.json.new
+mv -f config.json.new config.json
+sudo service darknode restart
+`
+	if err := client.Run(script); err != nil {
+		return err
+	}
+	fmt.Printf("%s[%s] has been restarted with its previous config.%s\n", GREEN, name, RESET)
+	fmt.Printf("Run `darknode config diff --name %v` to compare it with the local config.\n", name)
+
+	return nil
+}
+
+// bootstrapChange is the change of the bootstrap multiAddresses of a
+// Darknode.
+type bootstrapChange struct {
+	name    string
+	cfg     config.Config
+	removed []string
+	added   []string
+}
+
+// refreshBootstrap recomputes the bootstrap multiAddresses of the selected
+// Darknodes from the current definition of their networks. The changes are
+// shown and confirmed before the configs are rewritten, pushed to the
+// Darknodes and the Darknodes are restarted.
+func refreshBootstrap(ctx *cli.Context) error {
+	name := ctx.String("name")
+	tags := ctx.StringSlice("tag")
+	if name == "" && len(tags) == 0 {
+		cli.ShowCommandHelp(ctx, "refresh-bootstrap")
+		return ErrEmptyNodeName
+	}
+	nodes, err := selectNodesByNameOrTags(name, tags)
+	if err != nil {
+		return err
+	}
+	if len(nodes) == 0 {
+		return ErrNoNodesFound
+	}
+
+	changes := []bootstrapChange{}
+	for _, node := range nodes {
+		change, err := bootstrapDiff(node)
 		if err != nil {
-			return config.Config{}, nil
+			return err
+		}
+		if len(change.removed) == 0 && len(change.added) == 0 {
+			fmt.Printf("[%s] is up to date.\n", node.Name)
+			continue
+		}
+		fmt.Printf("[%s]\n", node.Name)
+		for _, multiAddress := range change.removed {
+			fmt.Printf("%s- %s%s\n", RED, multiAddress, RESET)
+		}
+		for _, multiAddress := range change.added {
+			fmt.Printf("%s+ %s%s\n", GREEN, multiAddress, RESET)
+		}
+		changes = append(changes, change)
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	if !ctx.Bool("yes") && !promptYesNo(fmt.Sprintf("Push the new bootstrap multiAddresses to %d Darknodes and restart them? (Yes/No)", len(changes))) {
+		return nil
+	}
+
+	errs := make(chan error, len(changes))
+	dispatch.CoForAll(changes, func(i int) {
+		if err := applyBootstrapChange(changes[i]); err != nil {
+			errs <- fmt.Errorf("%s[%s] cannot be refreshed: %v%s", RED, changes[i].name, err, RESET)
 		}
+	})
+	if len(errs) >= 1 {
+		return <-errs
 	}
 
-	return cfg, nil
+	return nil
 }
 
-// Fixme : right now the bootstrap node address are hardcoded
-func BootstrapNodes(network string) []identity.MultiAddress {
-	addresess := make([]identity.MultiAddress, 0)
-
-	switch network {
-	case "testnet":
-		b1, _ := identity.NewMultiAddressFromString("/ip4/54.250.246.106/tcp/18514/republic/8MJY6fvSCBCi3ujBqzTNTUkfF7WhFN")
-		b2, _ := identity.NewMultiAddressFromString("/ip4/13.209.15.151/tcp/18514/republic/8MGLgu2wx8h5iiZDVLsgKLhTXqP7Uj")
-		b3, _ := identity.NewMultiAddressFromString("/ip4/34.203.9.146/tcp/18514/republic/8MJBssiB8aT6pGAM6MYj7YNUJTgxt7")
-		b4, _ := identity.NewMultiAddressFromString("/ip4/34.245.26.34/tcp/18514/republic/8MG9AZnq9s8UGqUcMMeq3r7azc58Mk")
-		b5, _ := identity.NewMultiAddressFromString("/ip4/54.233.183.222/tcp/18514/republic/8MJ4LffVe6hDAha7AfKRt8Hr12xrVR")
-		addresess = append(addresess, b1, b2, b3, b4, b5)
-	case "falcon":
-		b1, _ := identity.NewMultiAddressFromString("/ip4/13.124.184.167/tcp/18514/republic/8MJw8s6TVKmQH3kdM5kJUYqPmh3JmF")
-		b2, _ := identity.NewMultiAddressFromString("/ip4/52.79.235.44/tcp/18514/republic/8MJEFcsQ5G8XMg5vka1XhswQotjbbj")
-		b3, _ := identity.NewMultiAddressFromString("/ip4/13.114.234.59/tcp/18514/republic/8MKKUenZG8inoZqd8boYxGb1J3waAg")
-		b4, _ := identity.NewMultiAddressFromString("/ip4/35.154.181.5/tcp/18514/republic/8MJNi8mgfQqD52bjUCnUzJ64uneJbk")
-		addresess = append(addresess, b1, b2, b3, b4)
-	case "nightly":
-		b1, _ := identity.NewMultiAddressFromString("/ip4/54.255.182.246/tcp/18514/republic/8MHgRa2Uj7Tj2cgoA1PoULso7UmgVi")
-		b2, _ := identity.NewMultiAddressFromString("/ip4/52.62.18.91/tcp/18514/republic/8MJnjSUVJCgP6YVjNWzaJXtiKE3p1o")
-		addresess = append(addresess, b1, b2)
-	default:
-		panic(ErrUnknownNetwork)
+// bootstrapDiff compares the bootstrap multiAddresses in the config of the
+// Darknode with the definition of its network. A Darknode which is itself a
+// bootstrap Darknode is not given its own multiAddress.
+func bootstrapDiff(node Node) (bootstrapChange, error) {
+	cfg, err := loadConfig(node.Name)
+	if err != nil {
+		return bootstrapChange{}, err
+	}
+	network, err := LoadNetwork(node.Network)
+	if err != nil {
+		return bootstrapChange{}, err
+	}
+	bootstrapNodes, err := network.BootstrapNodes()
+	if err != nil {
+		return bootstrapChange{}, err
+	}
+
+	change := bootstrapChange{name: node.Name}
+	current := map[string]bool{}
+	for _, multi := range cfg.BootstrapMultiAddresses {
+		current[multi.String()] = true
+	}
+	wanted := map[string]bool{}
+	multiAddresses := make([]identity.MultiAddress, 0, len(bootstrapNodes))
+	for _, multi := range bootstrapNodes {
+		if multi.Address() == cfg.Address {
+			continue
+		}
+		multiAddresses = append(multiAddresses, multi)
+		wanted[multi.String()] = true
+		if !current[multi.String()] {
+			change.added = append(change.added, multi.String())
+		}
+	}
+	for _, multi := range cfg.BootstrapMultiAddresses {
+		if !wanted[multi.String()] {
+			change.removed = append(change.removed, multi.String())
+		}
+	}
+	cfg.BootstrapMultiAddresses = multiAddresses
+	change.cfg = cfg
+
+	return change, nil
+}
+
+// applyBootstrapChange rewrites the local config of the Darknode, pushes it
+// to the Darknode and restarts the darknode service. The local config is
+// restored if it cannot be pushed, so the change is shown again next time.
+func applyBootstrapChange(change bootstrapChange) error {
+	configFile := NodeDirectory(change.name) + "/config.json"
+	previous, err := readSecret(configFile)
+	if err != nil {
+		return err
+	}
+	client, err := DialNode(change.name)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if err := saveConfig(change.name, change.cfg); err != nil {
+		return err
+	}
+	if err := pushConfig(client, change.name); err != nil {
+		if restoreErr := writeSecret(configFile, previous); restoreErr != nil {
+			return restoreErr
+		}
+		return err
+	}
+	if err := client.Run("sudo service darknode restart"); err != nil {
+		return err
 	}
+	fmt.Printf("%s[%s] has been restarted with the new bootstrap multiAddresses.%s\n", GREEN, change.name, RESET)
 
-	return addresess
+	return nil
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/republicprotocol/republic-go/contract"
+)
+
+func TestCheckPushedConfig(t *testing.T) {
+	defer useTempDirectory(t)()
+	cfg := testConfig(t)
+	cfg.Host, cfg.Port = "0.0.0.0", "18514"
+	cfg.Ethereum = contract.Config{Network: contract.NetworkTestnet, URI: "https://kovan.infura.io"}
+	writeFakeNode(t, "node", "server")
+	node, err := LoadNode("node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := node.SetMultiAddress("/ip4/1.2.3.4/tcp/18514/republic/" + string(cfg.Address)); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveNode(node); err != nil {
+		t.Fatal(err)
+	}
+	valid, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := testConfig(t)
+	other.Host, other.Port, other.Ethereum = cfg.Host, cfg.Port, cfg.Ethereum
+	changed, err := json.Marshal(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		description string
+		config      string
+		valid       bool
+	}{
+		{"valid config", string(valid), true},
+		{"invalid JSON", string(valid[:len(valid)-1]), false},
+		{"unknown key", strings.Replace(string(valid), `"host":`, `"hostname":"x","host":`, 1), false},
+		{"wrong type", strings.Replace(string(valid), `"port":"18514"`, `"port":18514`, 1), false},
+		{"invalid port", strings.Replace(string(valid), `"port":"18514"`, `"port":"0"`, 1), false},
+		{"changed address", string(changed), false},
+	}
+	for _, test := range tests {
+		_, err := checkPushedConfig("node", []byte(test.config))
+		if test.valid != (err == nil) {
+			t.Errorf("%v: unexpected error %v", test.description, err)
+		}
+	}
+}
@@ -0,0 +1,455 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/urfave/cli"
+)
+
+// Profile is a named set of credentials for the account of a cloud provider.
+// Only the fields of its provider are set.
+type Profile struct {
+	Name     string `json:"name"`
+	Provider string `json:"provider"`
+
+	// AwsProfile is the name of a profile in the shared AWS credentials
+	// file, used instead of the access keys. AwsRoleArn is an IAM role which
+	// is assumed with the credentials, using the MFA device AwsMfaSerial.
+	AwsProfile   string `json:"awsProfile,omitempty"`
+	AccessKey    string `json:"accessKey,omitempty"`
+	SecretKey    string `json:"secretKey,omitempty"`
+	AwsRoleArn   string `json:"awsRoleArn,omitempty"`
+	AwsMfaSerial string `json:"awsMfaSerial,omitempty"`
+
+	// Token is the Digital Ocean API token.
+	Token string `json:"token,omitempty"`
+
+	// CredentialsFile is the path of the GCP service account key file.
+	CredentialsFile string `json:"credentialsFile,omitempty"`
+
+	// Generated marks profiles created by the CLI for the credentials a
+	// Darknode was deployed with. They are removed together with the last
+	// Darknode using them.
+	Generated bool `json:"generated,omitempty"`
+}
+
+// CredentialsProvider is a Provider which needs the credentials of an account
+// to manage its Darknodes. The credentials can be stored in named profiles.
+type CredentialsProvider interface {
+	Provider
+
+	// CredentialsFlags returns the flag selecting the provider and the flags
+	// giving its credentials.
+	CredentialsFlags() []cli.Flag
+
+	// NewProfile reads the credentials of a new profile from the cli
+	// parameters.
+	NewProfile(ctx *cli.Context) (Profile, error)
+
+	// ProfileEnv returns the environment which passes the credentials of the
+	// profile to terraform.
+	ProfileEnv(profile Profile) ([]string, error)
+}
+
+// ProfilesFile returns the path of the file containing the credential
+// profiles. It is locked in the vault together with the secrets of the
+// Darknodes.
+func ProfilesFile() string {
+	return Directory + "/credentials.json"
+}
+
+// LoadProfiles reads all credential profiles, sorted by their providers and
+// names.
+func LoadProfiles() ([]Profile, error) {
+	data, err := readSecret(ProfilesFile())
+	if os.IsNotExist(err) {
+		return []Profile{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	profiles := []Profile{}
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, err
+	}
+
+	return profiles, nil
+}
+
+// SaveProfiles writes the credential profiles, locking them in the vault if
+// the vault is locked.
+func SaveProfiles(profiles []Profile) error {
+	sort.Slice(profiles, func(i, j int) bool {
+		if profiles[i].Provider != profiles[j].Provider {
+			return profiles[i].Provider < profiles[j].Provider
+		}
+		return profiles[i].Name < profiles[j].Name
+	})
+	data, err := json.MarshalIndent(profiles, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := writeSecret(ProfilesFile(), data); err != nil {
+		return err
+	}
+
+	return lockNewSecret(ProfilesFile())
+}
+
+// LoadProfile returns the credential profile of the provider with the given
+// name.
+func LoadProfile(provider, name string) (Profile, error) {
+	profiles, err := LoadProfiles()
+	if err != nil {
+		return Profile{}, err
+	}
+	for _, profile := range profiles {
+		if profile.Provider == provider && profile.Name == name {
+			return profile, nil
+		}
+	}
+
+	return Profile{}, fmt.Errorf("%scannot find the %v profile %q, see `darknode credentials list`%s", RED, provider, name, RESET)
+}
+
+// credentialsProviders returns the registered providers which use
+// credentials.
+func credentialsProviders() []CredentialsProvider {
+	credentialsProviders := []CredentialsProvider{}
+	for _, provider := range providers {
+		if provider, ok := provider.(CredentialsProvider); ok {
+			credentialsProviders = append(credentialsProviders, provider)
+		}
+	}
+
+	return credentialsProviders
+}
+
+// credentialsFlags returns the credentials flags of all providers.
+func credentialsFlags() []cli.Flag {
+	flags := []cli.Flag{}
+	for _, provider := range credentialsProviders() {
+		flags = append(flags, provider.CredentialsFlags()...)
+	}
+
+	return flags
+}
+
+// providerSelectionFlags returns the flags selecting the providers which use
+// credentials.
+func providerSelectionFlags() []cli.Flag {
+	flags := []cli.Flag{}
+	for _, flag := range credentialsFlags() {
+		if _, ok := flag.(cli.BoolFlag); ok {
+			flags = append(flags, flag)
+		}
+	}
+
+	return flags
+}
+
+// selectedCredentialsProvider returns the provider chosen by the user, which
+// must use credentials.
+func selectedCredentialsProvider(ctx *cli.Context) (CredentialsProvider, error) {
+	provider, err := selectedProvider(ctx)
+	if err != nil {
+		return nil, err
+	}
+	credentialsProvider, ok := provider.(CredentialsProvider)
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+
+	return credentialsProvider, nil
+}
+
+// selectedProfile returns the profile chosen with --profile for deploying a
+// Darknode, or nil if no profile is chosen. Credentials cannot be given both
+// by a profile and by flags.
+func selectedProfile(ctx *cli.Context, provider CredentialsProvider) (*Profile, error) {
+	name := ctx.String("profile")
+	if name == "" {
+		return nil, nil
+	}
+	for _, flag := range provider.CredentialsFlags() {
+		if _, ok := flag.(cli.StringFlag); ok && ctx.IsSet(flag.GetName()) {
+			return nil, ErrProfileAndCredentials
+		}
+	}
+	profile, err := LoadProfile(provider.Name(), name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &profile, nil
+}
+
+// deployEnv returns the environment which passes the credentials for
+// deploying a Darknode to terraform. The credentials of the profile chosen
+// with --profile are used, otherwise the credentials are read by defaultEnv.
+func deployEnv(ctx *cli.Context, provider CredentialsProvider, defaultEnv func() ([]string, error)) ([]string, error) {
+	profile, err := selectedProfile(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+	if profile == nil {
+		return defaultEnv()
+	}
+
+	return provider.ProfileEnv(*profile)
+}
+
+// nodeEnv returns the environment which passes the credentials for managing
+// the Darknode with the given name to terraform. The credentials of the
+// profile which deployed the Darknode are used, otherwise the credentials are
+// read by defaultEnv.
+func nodeEnv(name string, provider CredentialsProvider, defaultEnv func() ([]string, error)) ([]string, error) {
+	node, err := upgradeNode(name)
+	if err != nil {
+		return nil, err
+	}
+	if node.Profile == "" {
+		return defaultEnv()
+	}
+	profile, err := LoadProfile(provider.Name(), node.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	return provider.ProfileEnv(profile)
+}
+
+// saveNodeProfile stores credentials which the Darknode was deployed with
+// outside of a profile as a generated profile named after the Darknode, and
+// sets it as the profile of the Darknode. An existing profile with the same
+// credentials is reused. The node.json is not saved.
+func saveNodeProfile(node Node, profile Profile) (Node, error) {
+	profiles, err := LoadProfiles()
+	if err != nil {
+		return node, err
+	}
+	profile.Provider = node.Provider
+	names := map[string]bool{}
+	for _, existing := range profiles {
+		if existing.Provider != profile.Provider {
+			continue
+		}
+		if sameCredentials(existing, profile) {
+			node.Profile = existing.Name
+			return node, nil
+		}
+		names[existing.Name] = true
+	}
+	profile.Name, profile.Generated = node.Name, true
+	for i := 2; names[profile.Name]; i++ {
+		profile.Name = fmt.Sprintf("%v-%d", node.Name, i)
+	}
+	if err := SaveProfiles(append(profiles, profile)); err != nil {
+		return node, err
+	}
+	node.Profile = profile.Name
+
+	return node, nil
+}
+
+// sameCredentials returns whether both profiles contain the same
+// credentials, ignoring their names.
+func sameCredentials(a, b Profile) bool {
+	a.Name, a.Generated = "", false
+	b.Name, b.Generated = "", false
+
+	return a == b
+}
+
+// releaseNodeProfile removes the generated profile of a destroyed Darknode
+// once no other Darknode uses it. Profiles added by the user are kept.
+func releaseNodeProfile(node Node) error {
+	if node.Profile == "" {
+		return nil
+	}
+	profiles, err := LoadProfiles()
+	if err != nil {
+		return err
+	}
+	nodes, err := LoadAllNodes()
+	if err != nil {
+		return err
+	}
+	for _, other := range nodes {
+		if other.Name != node.Name && other.Provider == node.Provider && other.Profile == node.Profile {
+			return nil
+		}
+	}
+	remaining := []Profile{}
+	for _, profile := range profiles {
+		if profile.Provider != node.Provider || profile.Name != node.Profile || !profile.Generated {
+			remaining = append(remaining, profile)
+		}
+	}
+	if len(remaining) == len(profiles) {
+		return nil
+	}
+
+	return SaveProfiles(remaining)
+}
+
+// addProfile stores the credentials given by the user as a new profile.
+func addProfile(ctx *cli.Context) error {
+	name := ctx.String("name")
+	if name == "" {
+		cli.ShowCommandHelp(ctx, "add")
+		return ErrEmptyProfileName
+	}
+	provider, err := selectedCredentialsProvider(ctx)
+	if err != nil {
+		return err
+	}
+	profiles, err := LoadProfiles()
+	if err != nil {
+		return err
+	}
+	for _, profile := range profiles {
+		if profile.Provider == provider.Name() && profile.Name == name {
+			return fmt.Errorf("%sthe %v profile %q already exists%s", RED, provider.Name(), name, RESET)
+		}
+	}
+
+	profile, err := provider.NewProfile(ctx)
+	if err != nil {
+		return err
+	}
+	profile.Name, profile.Provider = name, provider.Name()
+	if err := SaveProfiles(append(profiles, profile)); err != nil {
+		return err
+	}
+	fmt.Printf("%sThe %v profile %q has been added, deploy with `darknode up --%v --profile %v`.%s\n", GREEN, provider.Name(), name, provider.Name(), name, RESET)
+
+	return nil
+}
+
+// listProfiles prints the credential profiles without their secrets.
+func listProfiles(ctx *cli.Context) error {
+	profiles, err := LoadProfiles()
+	if err != nil {
+		return err
+	}
+	table := [][]string{{"provider", "name", "credentials"}}
+	for _, profile := range profiles {
+		credentials := describeProfile(profile)
+		if profile.Generated {
+			credentials += " (generated)"
+		}
+		table = append(table, []string{profile.Provider, profile.Name, credentials})
+	}
+
+	return printTable(os.Stdout, table)
+}
+
+// describeProfile describes the credentials of the profile without revealing
+// them.
+func describeProfile(profile Profile) string {
+	switch {
+	case profile.AwsRoleArn != "":
+		return "role " + profile.AwsRoleArn
+	case profile.AwsProfile != "":
+		return "shared profile " + profile.AwsProfile
+	case profile.AccessKey != "":
+		return "access key " + profile.AccessKey
+	case profile.Token != "":
+		return "API token " + maskSecret(profile.Token)
+	case profile.CredentialsFile != "":
+		return "key file " + profile.CredentialsFile
+	}
+
+	return Unknown
+}
+
+// maskSecret hides all but the last four characters of the secret.
+func maskSecret(secret string) string {
+	if len(secret) <= 4 {
+		return "****"
+	}
+
+	return "****" + secret[len(secret)-4:]
+}
+
+// removeProfile removes a credential profile. Profiles still used by
+// Darknodes are only removed with --force, as the Darknodes cannot be
+// destroyed with their profile afterwards.
+func removeProfile(ctx *cli.Context) error {
+	name := ctx.String("name")
+	if name == "" {
+		cli.ShowCommandHelp(ctx, "remove")
+		return ErrEmptyProfileName
+	}
+	profiles, err := LoadProfiles()
+	if err != nil {
+		return err
+	}
+	provider, err := selectedCredentialsProvider(ctx)
+	if err == ErrNilProvider {
+		provider, err = profileProvider(profiles, name)
+	}
+	if err != nil {
+		return err
+	}
+
+	remaining := []Profile{}
+	for _, profile := range profiles {
+		if profile.Provider != provider.Name() || profile.Name != name {
+			remaining = append(remaining, profile)
+		}
+	}
+	if len(remaining) == len(profiles) {
+		_, err := LoadProfile(provider.Name(), name)
+		return err
+	}
+	if !ctx.Bool("force") {
+		nodes, err := LoadAllNodes()
+		if err != nil {
+			return err
+		}
+		for _, node := range nodes {
+			if node.Provider == provider.Name() && node.Profile == name {
+				return fmt.Errorf("%sthe %v profile %q is used by [%s], use --force to remove it anyway%s", RED, provider.Name(), name, node.Name, RESET)
+			}
+		}
+	}
+	if err := SaveProfiles(remaining); err != nil {
+		return err
+	}
+	fmt.Printf("%sThe %v profile %q has been removed.%s\n", GREEN, provider.Name(), name, RESET)
+
+	return nil
+}
+
+// profileProvider returns the provider of the only profile with the given
+// name.
+func profileProvider(profiles []Profile, name string) (CredentialsProvider, error) {
+	var found *Profile
+	for i := range profiles {
+		if profiles[i].Name != name {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("%sthere are profiles named %q for several providers, please choose the provider%s", RED, name, RESET)
+		}
+		found = &profiles[i]
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%scannot find the profile %q, see `darknode credentials list`%s", RED, name, RESET)
+	}
+	provider, err := GetProvider(found.Provider)
+	if err != nil {
+		return nil, err
+	}
+	credentialsProvider, ok := provider.(CredentialsProvider)
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+
+	return credentialsProvider, nil
+}
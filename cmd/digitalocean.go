@@ -0,0 +1,327 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/republicprotocol/republic-go/cmd/darknode/config"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	RegisterProvider(DigitalOceanProvider{})
+}
+
+// Available regions on Digital Ocean.
+const (
+	Ams2 = "ams2"
+	Ams3 = "ams3"
+	Blr1 = "blr1"
+	Fra1 = "fra1"
+	Lon1 = "lon1"
+	Nyc1 = "nyc1"
+	Nyc3 = "nyc3"
+	Sfo1 = "sfo1"
+	Sfo2 = "sfo2"
+	Sgp1 = "sgp1"
+	Tor1 = "tor1"
+)
+
+// AllDoRegions contains all regions available on Digital Ocean.
+var AllDoRegions = []string{
+	Ams2,
+	Ams3,
+	Blr1,
+	Fra1,
+	Lon1,
+	Nyc1,
+	Nyc3,
+	Sfo1,
+	Sfo2,
+	Sgp1,
+	Tor1,
+}
+
+// Available droplet sizes on Digital Ocean.
+const (
+	S1Vcpu1Gb  = "s-1vcpu-1gb"
+	S1Vcpu2Gb  = "s-1vcpu-2gb"
+	S1Vcpu3Gb  = "s-1vcpu-3gb"
+	S2Vcpu2Gb  = "s-2vcpu-2gb"
+	S2Vcpu4Gb  = "s-2vcpu-4gb"
+	S3Vcpu1Gb  = "s-3vcpu-1gb"
+	S4Vcpu8Gb  = "s-4vcpu-8gb"
+	S6Vcpu16Gb = "s-6vcpu-16gb"
+	S8Vcpu32Gb = "s-8vcpu-32gb"
+)
+
+// AllDoDroplets contains all droplet sizes available on Digital Ocean.
+var AllDoDroplets = []string{
+	S1Vcpu1Gb,
+	S1Vcpu2Gb,
+	S1Vcpu3Gb,
+	S2Vcpu2Gb,
+	S2Vcpu4Gb,
+	S3Vcpu1Gb,
+	S4Vcpu8Gb,
+	S6Vcpu16Gb,
+	S8Vcpu32Gb,
+}
+
+// DigitalOceanProvider deploys Darknodes to Digital Ocean droplets using
+// terraform.
+type DigitalOceanProvider struct{}
+
+// Name implements the Provider interface.
+func (do DigitalOceanProvider) Name() string {
+	return "digitalocean"
+}
+
+// CredentialsFlags implements the CredentialsProvider interface.
+func (do DigitalOceanProvider) CredentialsFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.BoolFlag{
+			Name:  "digitalocean",
+			Usage: "Digital Ocean will be used to provision the Darknode",
+		},
+		cli.StringFlag{
+			Name:  "do-token",
+			Usage: "Digital Ocean API `token` for programmatic access",
+		},
+	}
+}
+
+// Flags implements the Provider interface.
+func (do DigitalOceanProvider) Flags() []cli.Flag {
+	return append(do.CredentialsFlags(),
+		cli.StringFlag{
+			Name:  "do-region",
+			Usage: "An optional Digital Ocean region (default: random)",
+		},
+		cli.StringFlag{
+			Name:  "do-droplet",
+			Value: S2Vcpu4Gb,
+			Usage: "An optional Digital Ocean droplet size",
+		},
+	)
+}
+
+// Selected implements the Provider interface.
+func (do DigitalOceanProvider) Selected(ctx *cli.Context) bool {
+	return ctx.Bool("digitalocean")
+}
+
+// Deploy parses the Digital Ocean token and use terraform to deploy the node
+// to a droplet.
+func (do DigitalOceanProvider) Deploy(ctx *cli.Context) error {
+	// Try getting the token from the profile, the input or the environment.
+	env, err := deployEnv(ctx, do, func() ([]string, error) {
+		return doEnv(ctx.String("do-token"))
+	})
+	if err != nil {
+		return err
+	}
+
+	// Parse region and droplet size
+	region, droplet, err := parseDoRegionAndDroplet(ctx)
+	if err != nil {
+		return err
+	}
+	nodeDirectory, config, pubKey, err := initNode(ctx, do, region, droplet)
+	if err != nil {
+		return err
+	}
+	if err := rememberDoToken(ctx.String("name"), ctx.String("do-token")); err != nil {
+		if err := cleanUp(nodeDirectory); err != nil {
+			return err
+		}
+		return err
+	}
+	if err := generateDoTerraformConfig(config, region, droplet, pubKey, nodeDirectory); err != nil {
+		if err := cleanUp(nodeDirectory); err != nil {
+			return err
+		}
+		return err
+	}
+	if err := runTerraform(nodeDirectory, env); err != nil {
+		if err := cleanUp(nodeDirectory); err != nil {
+			return err
+		}
+		return err
+	}
+
+	return finishDeployment(ctx)
+}
+
+// Destroy implements the Provider interface.
+func (do DigitalOceanProvider) Destroy(name string) error {
+	env, err := do.nodeEnv(name)
+	if err != nil {
+		return err
+	}
+
+	return destroyTerraformNode(NodeDirectory(name), env)
+}
+
+// Start implements the Provider interface.
+func (do DigitalOceanProvider) Start(name string) error {
+	return runRemoteScript(name, "sudo systemctl start darknode")
+}
+
+// Stop implements the Provider interface.
+func (do DigitalOceanProvider) Stop(name string) error {
+	return runRemoteScript(name, "sudo systemctl stop darknode")
+}
+
+// Resize changes the size of the droplet and applies the change with
+// terraform. Digital Ocean keeps the IP address of a resized droplet.
+func (do DigitalOceanProvider) Resize(name, droplet string) error {
+	if !StringInSlice(droplet, AllDoDroplets) {
+		return ErrUnknownDropletSize
+	}
+	env, err := do.nodeEnv(name)
+	if err != nil {
+		return err
+	}
+	nodeDirectory := NodeDirectory(name)
+	data, err := readSecret(nodeDirectory + "/main.tf")
+	if err != nil {
+		return err
+	}
+	dropletSize := regexp.MustCompile(`droplet_size = ".*"`)
+	data = dropletSize.ReplaceAll(data, []byte(fmt.Sprintf(`droplet_size = "%v"`, droplet)))
+	if err := writeSecret(nodeDirectory+"/main.tf", data); err != nil {
+		return err
+	}
+
+	return runTerraform(nodeDirectory, env)
+}
+
+// Status implements the Provider interface.
+func (do DigitalOceanProvider) Status(name string) (string, error) {
+	return serviceStatus(name)
+}
+
+// NewProfile implements the CredentialsProvider interface. The API token is
+// asked for if it is not given.
+func (do DigitalOceanProvider) NewProfile(ctx *cli.Context) (Profile, error) {
+	token := ctx.String("do-token")
+	if token == "" {
+		var err error
+		if token, err = readPassphrase("Digital Ocean API token: "); err != nil {
+			return Profile{}, err
+		}
+	}
+	if token == "" {
+		return Profile{}, ErrDoTokenNotFound
+	}
+
+	return Profile{Token: token}, nil
+}
+
+// ProfileEnv implements the CredentialsProvider interface.
+func (do DigitalOceanProvider) ProfileEnv(profile Profile) ([]string, error) {
+	return doEnv(profile.Token)
+}
+
+// nodeEnv returns the environment for running terraform for the Darknode,
+// using the profile it was deployed with, or the token in the environment.
+func (do DigitalOceanProvider) nodeEnv(name string) ([]string, error) {
+	return nodeEnv(name, do, func() ([]string, error) {
+		return doEnv("")
+	})
+}
+
+// rememberDoToken stores the API token given with --do-token in a generated
+// profile of the Darknode, so the Darknode can be resized and destroyed with
+// the same account. A token in the environment is read again when needed.
+func rememberDoToken(name, token string) error {
+	if token == "" {
+		return nil
+	}
+	node, err := LoadNode(name)
+	if err != nil {
+		return err
+	}
+	if node.Profile != "" {
+		return nil
+	}
+	if node, err = saveNodeProfile(node, Profile{Token: token}); err != nil {
+		return err
+	}
+
+	return SaveNode(node)
+}
+
+// parseDoRegionAndDroplet parses the region and the droplet size from the
+// cli parameters. It will randomly pick a region for the user if it's not
+// specified.
+func parseDoRegionAndDroplet(ctx *cli.Context) (string, string, error) {
+	region := strings.ToLower(ctx.String("do-region"))
+	droplet := strings.ToLower(ctx.String("do-droplet"))
+
+	rand.Seed(time.Now().UTC().UnixNano())
+	if region == "" {
+		region = AllDoRegions[rand.Intn(len(AllDoRegions))]
+	} else {
+		if !StringInSlice(region, AllDoRegions) {
+			return "", "", ErrUnknownDoRegion
+		}
+	}
+	if !StringInSlice(droplet, AllDoDroplets) {
+		return "", "", ErrUnknownDropletSize
+	}
+
+	return region, droplet, nil
+}
+
+// doEnv returns the environment which passes the Digital Ocean API token to
+// terraform. If no token is given, it is read from the environment.
+func doEnv(token string) ([]string, error) {
+	if token == "" {
+		token = os.Getenv("DIGITALOCEAN_TOKEN")
+		if token == "" {
+			return nil, ErrDoTokenNotFound
+		}
+	}
+
+	return []string{"DIGITALOCEAN_TOKEN=" + token}, nil
+}
+
+func generateDoTerraformConfig(config config.Config, region, droplet, pubKey, nodeDirectory string) error {
+	hostKey, err := newHostKey(nodeDirectory)
+	if err != nil {
+		return err
+	}
+	terraformConfig := fmt.Sprintf(`
+variable "ssh_public_key" {
+	default = "%v"
+}
+
+variable "ssh_private_key_location" {
+	default = "%v"
+}
+	`, strings.TrimSpace(pubKey), nodeDirectory+"/ssh_keypair")
+
+	mode := fmt.Sprintf(`
+module "node-%v" {
+    source = "%v/instance/do"
+    region = "%v"
+    id = "%v"
+    droplet_size = "%v"
+    ssh_public_key = "${var.ssh_public_key}"
+    ssh_private_key_location = "${var.ssh_private_key_location}"
+    config = "%v/config.json"
+    port = "%v"
+    path = "%v"
+    user_data = "${file("%v/user_data.yml")}"
+    host_key = "%v"
+}`, config.Address, Directory, region, config.Address, droplet, nodeDirectory, config.Port, Directory, nodeDirectory, hostKey)
+
+	return ioutil.WriteFile(nodeDirectory+"/main.tf", []byte(terraformConfig+mode), 0600)
+}
@@ -1,19 +1,16 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
 	"os"
 	"os/exec"
-	"strings"
 
+	"github.com/republicprotocol/republic-go/contract"
 	"github.com/urfave/cli"
 )
 
 // destroyNode tears down the deployed darknode, but keep the config file.
 func destroyNode(ctx *cli.Context) error {
-	// FIXME : currently it only supports tear down AWS deployment.
-	// Needs to figure out way which suits for all kinds of cloud service.
 	force := ctx.Bool("force")
 	name := ctx.String("name")
 
@@ -22,38 +19,49 @@ func destroyNode(ctx *cli.Context) error {
 		return ErrEmptyNodeName
 	}
 
-	nodeDirectory := Directory + "/darknodes/" + name
+	node, err := upgradeNode(name)
+	if err != nil {
+		return err
+	}
+	provider, err := GetProvider(node.Provider)
+	if err != nil {
+		return err
+	}
 	if !force {
-		ip, err := getIp(nodeDirectory)
-		if err != nil {
-			return ErrNoDeploymentFound
+		if err := confirmMainnet(contract.Network(node.Network), fmt.Sprintf("destroy [%s]", name)); err != nil {
+			return err
 		}
-
-		for {
-			fmt.Printf("You need to %sderegister your Darknode%s and %swithdraw all fees%s at\n", RED, RESET, RED, RESET)
-			fmt.Printf("https://darknode.republicprotocol.com/status/%v\n", ip)
-			fmt.Println("Have you deregistered your Darknode and withdrawn all fees? (Yes/No)")
-
-			reader := bufio.NewReader(os.Stdin)
-			text, _ := reader.ReadString('\n')
-			input := strings.ToLower(strings.TrimSpace(text))
-			if input == "yes" || input == "y" {
-				break
-			}
-			if input == "no" || input == "n" {
-				return nil
-			}
+		if err := checkRefunded(name); err != nil {
+			return err
+		}
+		fmt.Printf("You need to %swithdraw all fees%s earned by your Darknode at\n", RED, RESET)
+		fmt.Printf("https://darknode.republicprotocol.com/status/%v\n", node.IP)
+		if !promptYesNo("Have you withdrawn all fees? (Yes/No)") {
+			return nil
 		}
 	}
 
-	return destroyAwsNode(nodeDirectory)
+	if err := provider.Destroy(name); err != nil {
+		return err
+	}
+
+	return releaseNodeProfile(node)
 }
 
-// destroyAwsNode tears down the AWS instance.
-func destroyAwsNode(nodeDirectory string) error {
+// destroyTerraformNode tears down the instance created by terraform and
+// removes the node directory. The credentials of the cloud provider are passed
+// in the environment.
+func destroyTerraformNode(nodeDirectory string, env []string) error {
+	relock, err := unlockNodeDirectory(nodeDirectory)
+	if err != nil {
+		return err
+	}
+	defer relock()
+
 	fmt.Printf("%sDestroying your darknode ...%s\n", GREEN, RESET)
 	cmd := fmt.Sprintf("cd %v && terraform destroy --force && rm -rf %v", nodeDirectory, nodeDirectory)
 	destroy := exec.Command("bash", "-c", cmd)
+	destroy.Env = append(os.Environ(), env...)
 	pipeToStd(destroy)
 	if err := destroy.Start(); err != nil {
 		return err
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/republicprotocol/republic-go/cmd/darknode/config"
+	"github.com/republicprotocol/republic-go/identity"
+	"github.com/urfave/cli"
+)
+
+// editableConfigKeys are the top-level keys of the config which can be
+// changed with `darknode config set`. The keystore and the address derived
+// from it identify the Darknode and cannot be changed.
+var editableConfigKeys = []string{"host", "port", "logs", "ethereum", "bootstrapMultiAddresses"}
+
+// getConfig prints the value of the key in the config of the Darknode, or the
+// whole config without the keystore if no key is given.
+func getConfig(ctx *cli.Context) error {
+	name := ctx.String("name")
+	key := ctx.Args().First()
+	if name == "" {
+		cli.ShowCommandHelp(ctx, "get")
+		return ErrEmptyNodeName
+	}
+	document, err := readConfigDocument(NodeDirectory(name) + "/config.json")
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		delete(document.(map[string]interface{}), "keystore")
+		return printConfigValue(document)
+	}
+	path := strings.Split(key, ".")
+	if strings.EqualFold(path[0], "keystore") {
+		return ErrConfigKeystore
+	}
+	value, err := configValue(document, path)
+	if err != nil {
+		return err
+	}
+
+	return printConfigValue(value)
+}
+
+// setConfig sets the key in the local config of the Darknode to the value.
+// Values of string fields are taken as they are, other values are parsed as
+// JSON. The config is only written if it is still a valid config with the
+// same address.
+func setConfig(ctx *cli.Context) error {
+	name := ctx.String("name")
+	key, value := ctx.Args().Get(0), ctx.Args().Get(1)
+	if name == "" {
+		cli.ShowCommandHelp(ctx, "set")
+		return ErrEmptyNodeName
+	}
+	if key == "" || len(ctx.Args()) != 2 {
+		cli.ShowCommandHelp(ctx, "set")
+		return ErrEmptyConfigKey
+	}
+	path := strings.Split(key, ".")
+	switch {
+	case strings.EqualFold(path[0], "address"):
+		return ErrConfigAddress
+	case strings.EqualFold(path[0], "keystore"):
+		return ErrConfigKeystore
+	case !containsFold(editableConfigKeys, path[0]):
+		return fmt.Errorf("%scannot set %q, keys are %s%s", RED, key, strings.Join(editableConfigKeys, ", "), RESET)
+	}
+
+	configFile := NodeDirectory(name) + "/config.json"
+	original, err := loadConfig(name)
+	if err != nil {
+		return err
+	}
+	document, err := readConfigDocument(configFile)
+	if err != nil {
+		return err
+	}
+	previous, _ := configValue(document, path)
+	parsed, err := parseConfigValue(previous, value)
+	if err != nil {
+		return err
+	}
+	document, err = setConfigValue(document, path, parsed)
+	if err != nil {
+		return err
+	}
+	cfg, err := decodeConfig(document)
+	if err != nil {
+		return fmt.Errorf("%sinvalid value for %q: %v%s", RED, key, err, RESET)
+	}
+	if err := validateConfig(cfg, original); err != nil {
+		return err
+	}
+	if err := saveConfig(name, cfg); err != nil {
+		return err
+	}
+	fmt.Printf("%s%s of [%s] has been set in the local config.%s\n", GREEN, key, name, RESET)
+	fmt.Printf("Run `darknode update --name %v --config` to push it to the Darknode.\n", name)
+
+	return nil
+}
+
+// diffConfig shows the differences between the config on the Darknode and
+// its local config. The keystore is compared, but never printed.
+func diffConfig(ctx *cli.Context) error {
+	name := ctx.String("name")
+	if name == "" {
+		cli.ShowCommandHelp(ctx, "diff")
+		return ErrEmptyNodeName
+	}
+	local, err := readConfigDocument(NodeDirectory(name) + "/config.json")
+	if err != nil {
+		return err
+	}
+	client, err := DialNode(name)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	data, err := client.Output("cat $HOME/.darknode/config.json")
+	if err != nil {
+		return err
+	}
+	remote, err := decodeConfigDocument([]byte(data))
+	if err != nil {
+		return fmt.Errorf("%sthe config on [%s] is not valid JSON: %v%s", RED, name, err, RESET)
+	}
+
+	localValues, remoteValues := map[string]string{}, map[string]string{}
+	flattenConfig("", local, localValues)
+	flattenConfig("", remote, remoteValues)
+	keys := []string{}
+	for key := range localValues {
+		keys = append(keys, key)
+	}
+	for key := range remoteValues {
+		if _, ok := localValues[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	changed, keystoreChanged := false, false
+	for _, key := range keys {
+		remoteValue, inRemote := remoteValues[key]
+		localValue, inLocal := localValues[key]
+		if inRemote == inLocal && remoteValue == localValue {
+			continue
+		}
+		changed = true
+		if strings.HasPrefix(key, "keystore.") {
+			keystoreChanged = true
+			continue
+		}
+		if inRemote {
+			fmt.Printf("%s- %s: %s%s\n", RED, key, remoteValue, RESET)
+		}
+		if inLocal {
+			fmt.Printf("%s+ %s: %s%s\n", GREEN, key, localValue, RESET)
+		}
+	}
+	if keystoreChanged {
+		fmt.Printf("%s! the keystore differs%s\n", RED, RESET)
+	}
+	if !changed {
+		fmt.Printf("The config of [%s] is the same as the local config.\n", name)
+	}
+
+	return nil
+}
+
+// readConfigDocument reads the config file as generic JSON.
+func readConfigDocument(configFile string) (interface{}, error) {
+	data, err := readSecret(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeConfigDocument(data)
+}
+
+// decodeConfigDocument decodes the config as generic JSON. Numbers are kept as
+// they are written, so the keystore survives editing other keys.
+func decodeConfigDocument(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	document := map[string]interface{}{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+
+	return document, nil
+}
+
+// decodeConfig converts the generic JSON into a config, rejecting unknown
+// keys and values of the wrong type.
+func decodeConfig(document interface{}) (config.Config, error) {
+	data, err := json.Marshal(document)
+	if err != nil {
+		return config.Config{}, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	cfg := config.Config{}
+	if err := decoder.Decode(&cfg); err != nil {
+		return config.Config{}, err
+	}
+
+	return cfg, nil
+}
+
+// validateConfig checks the values of the config which the types of its
+// fields don't, and that the address of the Darknode has not changed.
+func validateConfig(cfg, original config.Config) error {
+	if cfg.Address != original.Address || cfg.Address != identity.Address(cfg.Keystore.Address()) {
+		return ErrConfigAddress
+	}
+	if cfg.Host == "" || strings.ContainsAny(cfg.Host, " \t\n") {
+		return fmt.Errorf("%sinvalid host %q%s", RED, cfg.Host, RESET)
+	}
+	if port, err := strconv.Atoi(cfg.Port); err != nil || port <= 0 || port > 65535 {
+		return fmt.Errorf("%sinvalid port %q%s", RED, cfg.Port, RESET)
+	}
+	if cfg.Ethereum.Network == "" {
+		return fmt.Errorf("%sethereum.network cannot be empty%s", RED, RESET)
+	}
+	if cfg.Ethereum.URI != "" {
+		uri, err := url.Parse(cfg.Ethereum.URI)
+		if err != nil || uri.Host == "" || !StringInSlice(uri.Scheme, []string{"http", "https", "ws", "wss"}) {
+			return fmt.Errorf("%sinvalid ethereum.uri %q%s", RED, cfg.Ethereum.URI, RESET)
+		}
+	}
+	addresses := map[string]string{
+		"republicTokenAddress":    cfg.Ethereum.RepublicTokenAddress,
+		"darknodeRegistryAddress": cfg.Ethereum.DarknodeRegistryAddress,
+		"orderbookAddress":        cfg.Ethereum.OrderbookAddress,
+		"rewardVaultAddress":      cfg.Ethereum.RewardVaultAddress,
+		"renExBalancesAddress":    cfg.Ethereum.RenExBalancesAddress,
+		"renExSettlementAddress":  cfg.Ethereum.RenExSettlementAddress,
+	}
+	for key, address := range addresses {
+		if address != "" && !common.IsHexAddress(address) {
+			return fmt.Errorf("%sinvalid ethereum.%s %q%s", RED, key, address, RESET)
+		}
+	}
+	for i, multi := range cfg.BootstrapMultiAddresses {
+		if multi.String() == "" {
+			return fmt.Errorf("%sbootstrapMultiAddresses.%d cannot be empty%s", RED, i, RESET)
+		}
+	}
+
+	return nil
+}
+
+// configValue returns the value at the path of keys in the generic JSON.
+// Object keys are matched ignoring case and array elements by their index.
+func configValue(document interface{}, path []string) (interface{}, error) {
+	value := document
+	for i, key := range path {
+		switch node := value.(type) {
+		case map[string]interface{}:
+			field, ok := findConfigKey(node, key)
+			if !ok {
+				return nil, fmt.Errorf("%sunknown config key %q%s", RED, strings.Join(path[:i+1], "."), RESET)
+			}
+			value = node[field]
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, fmt.Errorf("%sno element %q in %q%s", RED, key, strings.Join(path[:i], "."), RESET)
+			}
+			value = node[index]
+		default:
+			return nil, fmt.Errorf("%s%q has no key %q%s", RED, strings.Join(path[:i], "."), key, RESET)
+		}
+	}
+
+	return value, nil
+}
+
+// setConfigValue sets the value at the path of keys in the generic JSON and
+// returns the updated JSON. Arrays can be extended by one element at a time.
+func setConfigValue(document interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	key := path[0]
+	switch node := document.(type) {
+	case map[string]interface{}:
+		field, ok := findConfigKey(node, key)
+		if !ok {
+			field = key
+		}
+		child, err := setConfigValue(node[field], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		node[field] = child
+		return node, nil
+	case []interface{}:
+		index, err := strconv.Atoi(key)
+		if err != nil || index < 0 || index > len(node) {
+			return nil, fmt.Errorf("%sno element %q, arrays have %d elements%s", RED, key, len(node), RESET)
+		}
+		if index == len(node) {
+			node = append(node, nil)
+		}
+		child, err := setConfigValue(node[index], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		node[index] = child
+		return node, nil
+	case nil:
+		return setConfigValue(map[string]interface{}{}, path, value)
+	default:
+		return nil, fmt.Errorf("%scannot set %q inside a value which is not an object%s", RED, key, RESET)
+	}
+}
+
+// parseConfigValue parses the value given on the command-line. The value
+// replaces a string as it is, unless it is quoted. Values replacing anything
+// else must be JSON.
+func parseConfigValue(previous interface{}, value string) (interface{}, error) {
+	if _, ok := previous.(string); ok && !strings.HasPrefix(value, `"`) {
+		return value, nil
+	}
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.UseNumber()
+	var parsed interface{}
+	err := decoder.Decode(&parsed)
+	if err == nil && decoder.More() {
+		err = fmt.Errorf("unexpected data after the value")
+	}
+	if err != nil {
+		if previous == nil {
+			return value, nil
+		}
+		return nil, fmt.Errorf("%sthe value is not valid JSON: %v%s", RED, err, RESET)
+	}
+
+	return parsed, nil
+}
+
+// findConfigKey returns the key of the object which matches the key ignoring
+// case.
+func findConfigKey(object map[string]interface{}, key string) (string, bool) {
+	if _, ok := object[key]; ok {
+		return key, true
+	}
+	for field := range object {
+		if strings.EqualFold(field, key) {
+			return field, true
+		}
+	}
+
+	return "", false
+}
+
+// flattenConfig converts the generic JSON into JSON values by their paths of
+// keys.
+func flattenConfig(prefix string, value interface{}, values map[string]string) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+	switch node := value.(type) {
+	case map[string]interface{}:
+		for key, child := range node {
+			flattenConfig(join(key), child, values)
+		}
+	case []interface{}:
+		for i, child := range node {
+			flattenConfig(join(strconv.Itoa(i)), child, values)
+		}
+		if len(node) == 0 {
+			values[prefix] = "[]"
+		}
+	default:
+		data, _ := json.Marshal(node)
+		values[prefix] = string(data)
+	}
+}
+
+// printConfigValue prints strings as they are and other values as indented
+// JSON.
+func printConfigValue(value interface{}) error {
+	if s, ok := value.(string); ok {
+		fmt.Println(s)
+		return nil
+	}
+	data, err := json.MarshalIndent(value, "", "    ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+
+	return nil
+}
+
+// containsFold returns whether the list contains the string ignoring case.
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/republicprotocol/republic-go/cmd/darknode/config"
+	"github.com/republicprotocol/republic-go/contract"
+	"github.com/urfave/cli"
+)
+
+// ActionRefund is the pending action of refunding the bond of a deregistered
+// Darknode.
+const ActionRefund = "refund"
+
+// recordPendingRefund records a pending refund in the node.json of the
+// Darknode if it still holds a bond, and tells the user when the refund is
+// expected to become callable. It returns whether a refund is pending.
+func recordPendingRefund(registry Registry, name string, cfg config.Config) (bool, error) {
+	bond, err := registry.GetBond(cfg.Address.ID())
+	if err != nil {
+		return false, err
+	}
+	if bond.IsZero() {
+		return false, clearPendingRefund(name)
+	}
+	node, err := LoadNode(name)
+	if err != nil {
+		return false, err
+	}
+	if node.Pending == nil || node.Pending.Action != ActionRefund {
+		epoch, err := registry.Epoch()
+		if err != nil {
+			return false, err
+		}
+		node.Pending = &PendingAction{
+			Action:    ActionRefund,
+			CreatedAt: time.Now().UTC(),
+			Epoch:     epoch.BlockNumber,
+		}
+		if err := SaveNode(node); err != nil {
+			return false, err
+		}
+	}
+
+	interval, err := registry.MinimumEpochInterval()
+	if err != nil {
+		return false, err
+	}
+	fmt.Printf("The bond of %v REN can be refunded once the deregistration has completed at an epoch.\n", formatAmount(bond.ToBigInt()))
+	fmt.Printf("Epochs are at least %v apart, so expect the refund to become callable by %v.\n",
+		epochDuration(interval), node.Pending.CreatedAt.Add(2*epochDuration(interval)).Local().Format(time.RFC1123))
+
+	return true, nil
+}
+
+// clearPendingRefund removes the pending refund from the node.json of the
+// Darknode.
+func clearPendingRefund(name string) error {
+	node, err := LoadNode(name)
+	if err != nil {
+		return err
+	}
+	if node.Pending == nil || node.Pending.Action != ActionRefund {
+		return nil
+	}
+	node.Pending = nil
+
+	return SaveNode(node)
+}
+
+// waitForRefund stays in the foreground until the bond of the Darknode has
+// been refunded. The current epoch is checked every poll interval, and the
+// refund is attempted once in every new epoch after the deregistration has
+// completed.
+func waitForRefund(registry Registry, name string, cfg config.Config, poll time.Duration) error {
+	fmt.Printf("Waiting for the bond of [%s] to become refundable, press Ctrl+C to stop and run `darknode refund --pending` later ...\n", name)
+	for {
+		done, err := tryPendingRefund(registry, name, cfg)
+		if err != nil || done {
+			return err
+		}
+		time.Sleep(poll)
+	}
+}
+
+// tryPendingRefund refunds the bond of the Darknode if the refund is
+// callable. Each epoch is only attempted once, so a refund which is not
+// callable yet is not retried before the next epoch. It returns whether the
+// pending refund is finished.
+func tryPendingRefund(registry Registry, name string, cfg config.Config) (bool, error) {
+	node, err := LoadNode(name)
+	if err != nil {
+		return false, err
+	}
+	if node.Pending == nil || node.Pending.Action != ActionRefund {
+		return true, nil
+	}
+	epoch, err := registry.Epoch()
+	if err != nil {
+		return false, err
+	}
+	if epoch.BlockNumber == node.Pending.AttemptedEpoch {
+		return false, nil
+	}
+
+	deregistered, err := registry.IsDeregistered(cfg.Address.ID())
+	if err != nil {
+		return false, err
+	}
+	if deregistered {
+		err = refundDarknode(registry, name, cfg)
+		if err == nil {
+			return true, nil
+		}
+		fmt.Printf("%s[%s] cannot be refunded yet: %v%s\n", RED, name, err, RESET)
+	} else {
+		fmt.Printf("[%s] is waiting for the next epoch to complete its deregistration.\n", name)
+	}
+
+	fmt.Printf("[%s] will be retried in the next epoch.\n", name)
+	node.Pending.AttemptedEpoch = epoch.BlockNumber
+	return false, SaveNode(node)
+}
+
+// refundPending attempts to refund the bonds of all Darknodes with a pending
+// refund, using the key of the owner for all of them.
+func refundPending(ctx *cli.Context) error {
+	nodes, err := LoadAllNodes()
+	if err != nil {
+		return err
+	}
+	pending := []Node{}
+	for _, node := range nodes {
+		if node.Pending != nil && node.Pending.Action == ActionRefund {
+			pending = append(pending, node)
+		}
+	}
+	if len(pending) == 0 {
+		fmt.Printf("%sThere is no pending refund.%s\n", GREEN, RESET)
+		return nil
+	}
+
+	passphrase, err := flagPassphrase(ctx)
+	if err != nil {
+		return err
+	}
+	key, err := loadOwnerKey(ctx.String("keystore"), passphrase)
+	if err != nil {
+		return err
+	}
+	auth := bind.NewKeyedTransactor(key.PrivateKey)
+	registries := map[contract.Config]Registry{}
+	remaining := 0
+	for _, node := range pending {
+		cfg, err := loadConfig(node.Name)
+		if err != nil {
+			return err
+		}
+		registry, ok := registries[cfg.Ethereum]
+		if !ok {
+			registry, err = connectRegistry(cfg.Ethereum, auth)
+			if err != nil {
+				return err
+			}
+			registries[cfg.Ethereum] = registry
+		}
+		done, err := tryPendingRefund(registry, node.Name, cfg)
+		if err != nil {
+			return err
+		}
+		if !done {
+			remaining++
+		}
+	}
+	if remaining > 0 {
+		fmt.Printf("%d refunds are still pending, run `darknode refund --pending` again after the next epoch.\n", remaining)
+	}
+
+	return nil
+}
+
+// epochDuration converts the minimum epoch interval into a duration.
+func epochDuration(interval *big.Int) time.Duration {
+	if !interval.IsInt64() {
+		return 0
+	}
+
+	return time.Duration(interval.Int64()) * time.Second
+}
@@ -13,6 +13,17 @@ const (
 // ErrKeyNotFound is returned when no AWS access-key nor secret-key provided.
 var ErrKeyNotFound = fmt.Errorf("%splease provide your AWS access key and secret key%s", RED, RESET)
 
+// ErrDoTokenNotFound is returned when no Digital Ocean API token provided.
+var ErrDoTokenNotFound = fmt.Errorf("%splease provide your Digital Ocean API token%s", RED, RESET)
+
+// ErrGcpCredentialsNotFound is returned when no GCP service account
+// provided.
+var ErrGcpCredentialsNotFound = fmt.Errorf("%splease provide your GCP service account key file%s", RED, RESET)
+
+// ErrInvalidGcpCredentials is returned when the provided file is not a GCP
+// service account key file.
+var ErrInvalidGcpCredentials = fmt.Errorf("%sinvalid GCP service account key file%s", RED, RESET)
+
 // ErrNodeExist is returned when user tries to created a new node with name
 // already exists.
 var ErrNodeExist = fmt.Errorf("%snode with same name already exists%s", RED, RESET)
@@ -34,15 +45,131 @@ var UnknownRegion = fmt.Errorf("%sthere is no such region on AWS%s", RED, RESET)
 // supported in the selected region.
 var UnSupportedInstanceType = fmt.Errorf("%sinstance type is not supported in the region%s", RED, RESET)
 
+// ErrUnknownDoRegion is returned when the provided region is not valid on
+// Digital Ocean.
+var ErrUnknownDoRegion = fmt.Errorf("%sthere is no such region on Digital Ocean%s", RED, RESET)
+
+// ErrUnknownDropletSize is returned when the provided droplet size is not
+// valid on Digital Ocean.
+var ErrUnknownDropletSize = fmt.Errorf("%sthere is no such droplet size on Digital Ocean%s", RED, RESET)
+
+// ErrUnknownZone is returned when the provided zone is not valid on GCP.
+var ErrUnknownZone = fmt.Errorf("%sthere is no such zone on GCP%s", RED, RESET)
+
+// ErrUnknownMachineType is returned when the provided machine type is not
+// valid on GCP.
+var ErrUnknownMachineType = fmt.Errorf("%sthere is no such machine type on GCP%s", RED, RESET)
+
+// ErrResizeUnsupported is returned when the provider of the Darknode cannot
+// change its instance type.
+var ErrResizeUnsupported = fmt.Errorf("%sresizing is not supported by the provider of the node%s", RED, RESET)
+
+// ErrNoIPv4Address is returned when the server has no IPv4 address.
+var ErrNoIPv4Address = fmt.Errorf("%scannot find an IPv4 address of the server%s", RED, RESET)
+
+// ErrNoSSHAgent is returned when agent forwarding is requested but no ssh
+// agent is running.
+var ErrNoSSHAgent = fmt.Errorf("%scannot find a running ssh agent, SSH_AUTH_SOCK is not set%s", RED, RESET)
+
 // ErrNoNodesFound is returned when no nodes can be found with the given tag.
 var ErrNoNodesFound = fmt.Errorf("%sno nodes can be found with the given tag%s", RED, RESET)
 
+// ErrEmptyTags is returned when user doesn't provide any tag.
+var ErrEmptyTags = fmt.Errorf("%stags cannot be empty%s", RED, RESET)
+
+// ErrNameAndTags is returned when user selects Darknodes both by name and by
+// tags.
+var ErrNameAndTags = fmt.Errorf("%sselect Darknodes either by --name or by --tag, not both%s", RED, RESET)
+
 // ErrNoDeploymentFound is returned when no node can be found for destroying
 var ErrNoDeploymentFound = fmt.Errorf("%scannot find any deployed node%s", RED, RESET)
 
 // ErrEmptyNodeName is returned when user doesn't provide the node name.
 var ErrEmptyNodeName = fmt.Errorf("%snode name cannot be empty%s", RED, RESET)
 
-// ErrUnknownNetwork is returned when user wants to deploy darknode to an
-// unknown darkpool network
-var ErrUnknownNetwork = fmt.Errorf("%sunknown network%s", RED, RESET)
+// ErrEmptyOwnerKeystore is returned when user doesn't provide the keystore
+// of the owner of the Darknode.
+var ErrEmptyOwnerKeystore = fmt.Errorf("%splease provide the Ethereum keystore file of the owner with --keystore%s", RED, RESET)
+
+// ErrNoTerminal is returned when the user needs to be asked for a secret but
+// the standard input is not a terminal.
+var ErrNoTerminal = fmt.Errorf("%scannot ask for a passphrase, the standard input is not a terminal%s", RED, RESET)
+
+// ErrPassphraseAndFile is returned when user gives both a passphrase and a
+// passphrase file.
+var ErrPassphraseAndFile = fmt.Errorf("%splease provide either --passphrase or --passphrase-file, not both%s", RED, RESET)
+
+// ErrPassphraseMismatch is returned when the repeated passphrase is different.
+var ErrPassphraseMismatch = fmt.Errorf("%sthe passphrases do not match%s", RED, RESET)
+
+// ErrEmptyPassphrase is returned when user provides an empty passphrase for
+// encrypting a keystore.
+var ErrEmptyPassphrase = fmt.Errorf("%sthe passphrase cannot be empty%s", RED, RESET)
+
+// ErrIncompleteKeystore is returned when the Darknode keystore doesn't have
+// both an ECDSA and an RSA key.
+var ErrIncompleteKeystore = fmt.Errorf("%sthe Darknode keystore must contain both an ECDSA and an RSA key%s", RED, RESET)
+
+// ErrEmptyInstanceType is returned when user doesn't provide the instance
+// type.
+var ErrEmptyInstanceType = fmt.Errorf("%sinstance type cannot be empty%s", RED, RESET)
+
+// ErrNoMainnet is returned when user wants to use the mainnet before its
+// definition has been added.
+var ErrNoMainnet = fmt.Errorf("%sthe mainnet is not bundled with this release, add its definition with `darknode network add mainnet.json`%s", RED, RESET)
+
+// ErrMainnetNotConfirmed is returned when user doesn't confirm an action on
+// the mainnet.
+var ErrMainnetNotConfirmed = fmt.Errorf("%saction on the mainnet has not been confirmed%s", RED, RESET)
+
+// ErrNoLocalContracts is returned when the Darknode registry is used on a
+// local network whose contract addresses have not been defined.
+var ErrNoLocalContracts = fmt.Errorf("%sthe local network has no contract addresses, add the contracts of your dev chain with `darknode network local`%s", RED, RESET)
+
+// ErrEmptyConfigKey is returned when user doesn't provide the key and the
+// value to set in the config.
+var ErrEmptyConfigKey = fmt.Errorf("%splease provide the config key and its value%s", RED, RESET)
+
+// ErrConfigAddress is returned when user tries to change the address of the
+// Darknode in its config.
+var ErrConfigAddress = fmt.Errorf("%sthe address of the Darknode is derived from its keystore and cannot be changed%s", RED, RESET)
+
+// ErrConfigKeystore is returned when user tries to read or change the
+// keystore of the Darknode through its config.
+var ErrConfigKeystore = fmt.Errorf("%sthe keystore of the Darknode cannot be read or changed with config get and set%s", RED, RESET)
+
+// ErrEmptyNetworkName is returned when user doesn't provide the name of a
+// network.
+var ErrEmptyNetworkName = fmt.Errorf("%snetwork name cannot be empty%s", RED, RESET)
+
+// ErrEmptyNetworkFile is returned when user doesn't provide the file defining
+// a network.
+var ErrEmptyNetworkFile = fmt.Errorf("%snetwork file cannot be empty%s", RED, RESET)
+
+// ErrVaultNotLocked is returned when the vault is used before it has been
+// created with `darknode vault lock`.
+var ErrVaultNotLocked = fmt.Errorf("%sthe vault is not locked, lock it with `darknode vault lock`%s", RED, RESET)
+
+// ErrWrongVaultPassphrase is returned when the passphrase of the vault is
+// wrong.
+var ErrWrongVaultPassphrase = fmt.Errorf("%swrong passphrase of the vault%s", RED, RESET)
+
+// ErrNoCredentials is returned when credentials are managed for a provider
+// which does not use any.
+var ErrNoCredentials = fmt.Errorf("%sthe provider does not use credentials%s", RED, RESET)
+
+// ErrEmptyProfileName is returned when the name of a credential profile is
+// empty.
+var ErrEmptyProfileName = fmt.Errorf("%sprofile name cannot be empty%s", RED, RESET)
+
+// ErrProfileAndCredentials is returned when credentials are given both by a
+// profile and by flags.
+var ErrProfileAndCredentials = fmt.Errorf("%splease give either a profile or credentials, not both%s", RED, RESET)
+
+// ErrAwsProfileAndKeys is returned when an AWS profile is given together with
+// access keys.
+var ErrAwsProfileAndKeys = fmt.Errorf("%splease give either an AWS profile or access keys, not both%s", RED, RESET)
+
+// ErrAwsMfaWithoutRole is returned when an MFA device is given without a role
+// to assume.
+var ErrAwsMfaWithoutRole = fmt.Errorf("%sthe MFA device is only used to assume a role, please give --aws-role-arn%s", RED, RESET)
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/republicprotocol/republic-go/cmd/darknode/config"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	RegisterProvider(GcpProvider{})
+}
+
+// Available regions on GCP.
+const (
+	AsiaEast1              = "asia-east1"
+	AsiaNorthEast1         = "asia-northeast1"
+	AsiaSouth1             = "asia-south1"
+	AsiaSouthEast1         = "asia-southeast1"
+	AustraliaSouthEast1    = "australia-southeast1"
+	EuropeWest1            = "europe-west1"
+	EuropeWest2            = "europe-west2"
+	EuropeWest3            = "europe-west3"
+	EuropeWest4            = "europe-west4"
+	NorthAmericaNorthEast1 = "northamerica-northeast1"
+	SouthAmericaEast1      = "southamerica-east1"
+	UsCentral1             = "us-central1"
+	UsEast1Gcp             = "us-east1"
+	UsEast4                = "us-east4"
+	UsWest1Gcp             = "us-west1"
+)
+
+// AllGcpRegions contains all regions available on GCP.
+var AllGcpRegions = []string{
+	AsiaEast1,
+	AsiaNorthEast1,
+	AsiaSouth1,
+	AsiaSouthEast1,
+	AustraliaSouthEast1,
+	EuropeWest1,
+	EuropeWest2,
+	EuropeWest3,
+	EuropeWest4,
+	NorthAmericaNorthEast1,
+	SouthAmericaEast1,
+	UsCentral1,
+	UsEast1Gcp,
+	UsEast4,
+	UsWest1Gcp,
+}
+
+// GcpZones maps the region to its available zones.
+var GcpZones = map[string][]string{
+	AsiaEast1:              {"a", "b", "c"},
+	AsiaNorthEast1:         {"a", "b", "c"},
+	AsiaSouth1:             {"a", "b", "c"},
+	AsiaSouthEast1:         {"a", "b", "c"},
+	AustraliaSouthEast1:    {"a", "b", "c"},
+	EuropeWest1:            {"b", "c", "d"},
+	EuropeWest2:            {"a", "b", "c"},
+	EuropeWest3:            {"a", "b", "c"},
+	EuropeWest4:            {"a", "b", "c"},
+	NorthAmericaNorthEast1: {"a", "b", "c"},
+	SouthAmericaEast1:      {"a", "b", "c"},
+	UsCentral1:             {"a", "b", "c", "f"},
+	UsEast1Gcp:             {"b", "c", "d"},
+	UsEast4:                {"a", "b", "c"},
+	UsWest1Gcp:             {"a", "b", "c"},
+}
+
+// Available machine types on GCP.
+const (
+	F1Micro      = "f1-micro"
+	G1Small      = "g1-small"
+	N1Standard1  = "n1-standard-1"
+	N1Standard2  = "n1-standard-2"
+	N1Standard4  = "n1-standard-4"
+	N1Standard8  = "n1-standard-8"
+	N1Standard16 = "n1-standard-16"
+	N1HighMem2   = "n1-highmem-2"
+	N1HighMem4   = "n1-highmem-4"
+	N1HighMem8   = "n1-highmem-8"
+	N1HighCpu2   = "n1-highcpu-2"
+	N1HighCpu4   = "n1-highcpu-4"
+	N1HighCpu8   = "n1-highcpu-8"
+)
+
+// AllGcpMachineTypes contains all machine types available on GCP.
+var AllGcpMachineTypes = []string{
+	F1Micro,
+	G1Small,
+	N1Standard1,
+	N1Standard2,
+	N1Standard4,
+	N1Standard8,
+	N1Standard16,
+	N1HighMem2,
+	N1HighMem4,
+	N1HighMem8,
+	N1HighCpu2,
+	N1HighCpu4,
+	N1HighCpu8,
+}
+
+// gcpCredentials contains the fields we need from a service account key file.
+type gcpCredentials struct {
+	Type        string `json:"type"`
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+}
+
+// GcpProvider deploys Darknodes to GCP compute instances using terraform.
+type GcpProvider struct{}
+
+// Name implements the Provider interface.
+func (gcp GcpProvider) Name() string {
+	return "gcp"
+}
+
+// CredentialsFlags implements the CredentialsProvider interface.
+func (gcp GcpProvider) CredentialsFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.BoolFlag{
+			Name:  "gcp",
+			Usage: "Google Cloud Platform will be used to provision the Darknode",
+		},
+		cli.StringFlag{
+			Name:  "gcp-credentials",
+			Usage: "Service account key `file` in JSON format",
+		},
+	}
+}
+
+// Flags implements the Provider interface.
+func (gcp GcpProvider) Flags() []cli.Flag {
+	return append(gcp.CredentialsFlags(),
+		cli.StringFlag{
+			Name:  "gcp-project",
+			Usage: "An optional GCP project ID (default: the project of the service account)",
+		},
+		cli.StringFlag{
+			Name:  "gcp-zone",
+			Usage: "An optional GCP zone (default: random)",
+		},
+		cli.StringFlag{
+			Name:  "gcp-machine-type",
+			Value: N1Standard1,
+			Usage: "An optional GCP machine type",
+		},
+	)
+}
+
+// Selected implements the Provider interface.
+func (gcp GcpProvider) Selected(ctx *cli.Context) bool {
+	return ctx.Bool("gcp")
+}
+
+// Deploy parses the GCP service account and use terraform to deploy the node
+// to a compute instance.
+func (gcp GcpProvider) Deploy(ctx *cli.Context) error {
+	credentialsFile := ctx.String("gcp-credentials")
+	project := ctx.String("gcp-project")
+
+	// Try getting the service account from the profile, the input or the
+	// environment.
+	profile, err := selectedProfile(ctx, gcp)
+	if err != nil {
+		return err
+	}
+	if profile != nil {
+		credentialsFile = profile.CredentialsFile
+	}
+	if credentialsFile == "" {
+		credentialsFile = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+		if credentialsFile == "" {
+			return ErrGcpCredentialsNotFound
+		}
+	}
+	credentialsFile, err = filepath.Abs(credentialsFile)
+	if err != nil {
+		return err
+	}
+	credentials, err := readGcpCredentials(credentialsFile)
+	if err != nil {
+		return err
+	}
+	if project == "" {
+		project = credentials.ProjectID
+	}
+	env := gcpEnv(credentialsFile)
+
+	// Parse zone and machine type
+	region, zone, machine, err := parseZoneAndMachineType(ctx)
+	if err != nil {
+		return err
+	}
+	nodeDirectory, config, pubKey, err := initNode(ctx, gcp, zone, machine)
+	if err != nil {
+		return err
+	}
+	if err := rememberGcpCredentials(ctx.String("name"), credentialsFile); err != nil {
+		if err := cleanUp(nodeDirectory); err != nil {
+			return err
+		}
+		return err
+	}
+	if err := generateGcpTerraformConfig(config, project, region, zone, machine, pubKey, nodeDirectory); err != nil {
+		if err := cleanUp(nodeDirectory); err != nil {
+			return err
+		}
+		return err
+	}
+	if err := runTerraform(nodeDirectory, env); err != nil {
+		if err := cleanUp(nodeDirectory); err != nil {
+			return err
+		}
+		return err
+	}
+
+	return finishDeployment(ctx)
+}
+
+// Destroy implements the Provider interface.
+func (gcp GcpProvider) Destroy(name string) error {
+	env, err := gcp.nodeEnv(name)
+	if err != nil {
+		return err
+	}
+
+	return destroyTerraformNode(NodeDirectory(name), env)
+}
+
+// Start implements the Provider interface.
+func (gcp GcpProvider) Start(name string) error {
+	return runRemoteScript(name, "sudo systemctl start darknode")
+}
+
+// Stop implements the Provider interface.
+func (gcp GcpProvider) Stop(name string) error {
+	return runRemoteScript(name, "sudo systemctl stop darknode")
+}
+
+// Resize changes the machine type of the instance and applies the change with
+// terraform. The multiAddress is refreshed afterwards as the ephemeral IP of
+// the instance changes when it is restarted.
+func (gcp GcpProvider) Resize(name, machine string) error {
+	if !StringInSlice(machine, AllGcpMachineTypes) {
+		return ErrUnknownMachineType
+	}
+	env, err := gcp.nodeEnv(name)
+	if err != nil {
+		return err
+	}
+	nodeDirectory := NodeDirectory(name)
+	data, err := readSecret(nodeDirectory + "/main.tf")
+	if err != nil {
+		return err
+	}
+	machineType := regexp.MustCompile(`machine_type = ".*"`)
+	data = machineType.ReplaceAll(data, []byte(fmt.Sprintf(`machine_type = "%v"`, machine)))
+	if err := writeSecret(nodeDirectory+"/main.tf", data); err != nil {
+		return err
+	}
+	if err := runTerraform(nodeDirectory, env); err != nil {
+		return err
+	}
+
+	return refreshMultiAddress(name)
+}
+
+// Status implements the Provider interface.
+func (gcp GcpProvider) Status(name string) (string, error) {
+	return serviceStatus(name)
+}
+
+// readGcpCredentials reads and checks the service account key file.
+func readGcpCredentials(credentialsFile string) (gcpCredentials, error) {
+	data, err := ioutil.ReadFile(credentialsFile)
+	if err != nil {
+		return gcpCredentials{}, err
+	}
+	credentials := gcpCredentials{}
+	if err := json.Unmarshal(data, &credentials); err != nil {
+		return gcpCredentials{}, ErrInvalidGcpCredentials
+	}
+	if credentials.Type != "service_account" || credentials.ClientEmail == "" {
+		return gcpCredentials{}, ErrInvalidGcpCredentials
+	}
+
+	return credentials, nil
+}
+
+// NewProfile implements the CredentialsProvider interface. The profile refers
+// to the service account key file, the key itself is not copied.
+func (gcp GcpProvider) NewProfile(ctx *cli.Context) (Profile, error) {
+	credentialsFile := ctx.String("gcp-credentials")
+	if credentialsFile == "" {
+		return Profile{}, ErrGcpCredentialsNotFound
+	}
+	credentialsFile, err := filepath.Abs(credentialsFile)
+	if err != nil {
+		return Profile{}, err
+	}
+	if _, err := readGcpCredentials(credentialsFile); err != nil {
+		return Profile{}, err
+	}
+
+	return Profile{CredentialsFile: credentialsFile}, nil
+}
+
+// ProfileEnv implements the CredentialsProvider interface.
+func (gcp GcpProvider) ProfileEnv(profile Profile) ([]string, error) {
+	return gcpEnv(profile.CredentialsFile), nil
+}
+
+// nodeEnv returns the environment for running terraform for the Darknode,
+// using the profile it was deployed with, or the service account key file it
+// was deployed with, or the one in the environment.
+func (gcp GcpProvider) nodeEnv(name string) ([]string, error) {
+	return nodeEnv(name, gcp, func() ([]string, error) {
+		return nodeGcpEnv(name)
+	})
+}
+
+// gcpEnv returns the environment which passes the service account key file to
+// terraform.
+func gcpEnv(credentialsFile string) []string {
+	return []string{"GOOGLE_CREDENTIALS=" + credentialsFile}
+}
+
+// nodeGcpEnv returns the environment for running terraform for the Darknode,
+// using the service account key file it was deployed with, or the one in the
+// environment.
+func nodeGcpEnv(name string) ([]string, error) {
+	node, err := LoadNode(name)
+	if err != nil {
+		return nil, err
+	}
+	credentialsFile := node.CredentialsFile
+	if credentialsFile == "" {
+		credentialsFile = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+		if credentialsFile == "" {
+			return nil, ErrGcpCredentialsNotFound
+		}
+	}
+
+	return gcpEnv(credentialsFile), nil
+}
+
+// rememberGcpCredentials stores the path of the service account key file in
+// the node.json of the Darknode, so the Darknode can be resized and destroyed
+// with the same service account. The key itself is not copied.
+func rememberGcpCredentials(name, credentialsFile string) error {
+	node, err := LoadNode(name)
+	if err != nil {
+		return err
+	}
+	node.CredentialsFile = credentialsFile
+
+	return SaveNode(node)
+}
+
+// parseZoneAndMachineType parses the zone and the machine type from the cli
+// parameters. It will randomly pick a zone for the user if it's not
+// specified. It returns the region of the zone, the zone and the machine
+// type.
+func parseZoneAndMachineType(ctx *cli.Context) (string, string, string, error) {
+	zone := strings.ToLower(ctx.String("gcp-zone"))
+	machine := strings.ToLower(ctx.String("gcp-machine-type"))
+
+	// Parse the input zone or pick one zone randomly
+	rand.Seed(time.Now().UTC().UnixNano())
+	var region string
+	if zone == "" {
+		region = AllGcpRegions[rand.Intn(len(AllGcpRegions))]
+		zone = region + "-" + GcpZones[region][rand.Intn(len(GcpZones[region]))]
+	} else {
+		separator := strings.LastIndex(zone, "-")
+		if separator == -1 {
+			return "", "", "", ErrUnknownZone
+		}
+		region = zone[:separator]
+		if !StringInSlice(zone[separator+1:], GcpZones[region]) {
+			return "", "", "", ErrUnknownZone
+		}
+	}
+
+	// Parse the input machine type or use the default one.
+	if !StringInSlice(machine, AllGcpMachineTypes) {
+		return "", "", "", ErrUnknownMachineType
+	}
+
+	return region, zone, machine, nil
+}
+
+func generateGcpTerraformConfig(config config.Config, project, region, zone, machine, pubKey, nodeDirectory string) error {
+	hostKey, err := newHostKey(nodeDirectory)
+	if err != nil {
+		return err
+	}
+	terraformConfig := fmt.Sprintf(`
+variable "ssh_public_key" {
+	default = "%v"
+}
+
+variable "ssh_private_key_location" {
+	default = "%v"
+}
+	`, strings.TrimSpace(pubKey), nodeDirectory+"/ssh_keypair")
+
+	mode := fmt.Sprintf(`
+module "node-%v" {
+    source = "%v/instance/gcp"
+    project = "%v"
+    region = "%v"
+    zone = "%v"
+    id = "%v"
+    machine_type = "%v"
+    ssh_public_key = "${var.ssh_public_key}"
+    ssh_private_key_location = "${var.ssh_private_key_location}"
+    config = "%v/config.json"
+    port = "%v"
+    path = "%v"
+    user_data = "${file("%v/user_data.yml")}"
+    host_key = "%v"
+}`, config.Address, Directory, project, region, zone, config.Address, machine, nodeDirectory, config.Port, Directory, nodeDirectory, hostKey)
+
+	return ioutil.WriteFile(nodeDirectory+"/main.tf", []byte(terraformConfig+mode), 0600)
+}
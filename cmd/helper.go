@@ -1,12 +1,15 @@
 package main
 
 import (
+	"bufio"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"strings"
 
-	"github.com/republicprotocol/republic-go/identity"
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ssh/terminal"
 )
 
 // StringInSlice checks whether the string is in the slice
@@ -28,42 +31,86 @@ func pipeToStd(cmd *exec.Cmd) {
 	cmd.Stderr = os.Stderr
 }
 
-// getIp parses the ip address from a bytes representation of
-// multiAddress.
-func getIp(nodeDirectory string) (string, error) {
-	addressFile := nodeDirectory + "/multiAddress.out"
-	data, err := ioutil.ReadFile(addressFile)
+// promptYesNo asks the user the question until it gets a yes or no answer.
+func promptYesNo(question string) bool {
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Println(question)
+		text, _ := reader.ReadString('\n')
+		input := strings.ToLower(strings.TrimSpace(text))
+		if input == "yes" || input == "y" {
+			return true
+		}
+		if input == "no" || input == "n" {
+			return false
+		}
+	}
+}
+
+// runRemoteScript runs the script on the Darknode with the given name over
+// ssh.
+func runRemoteScript(name, script string) error {
+	client, err := DialNode(name)
 	if err != nil {
-		return "", err
+		return err
 	}
-	multi, err := identity.NewMultiAddressFromString(strings.TrimSpace(string(data)))
+	defer client.Close()
+
+	return client.Run(script)
+}
+
+// serviceStatus returns the state of the darknode service reported by
+// systemd on the Darknode with the given name.
+func serviceStatus(name string) (string, error) {
+	client, err := DialNode(name)
 	if err != nil {
 		return "", err
 	}
+	defer client.Close()
+
+	// systemctl exits with a non-zero code when the service is not active,
+	// so the output is preferred over the error.
+	output, err := client.Output("systemctl is-active darknode")
+	status := strings.TrimSpace(output)
+	if status == "" && err != nil {
+		return "", err
+	}
 
-	return multi.ValueForProtocol(identity.IP4Code)
+	return status, nil
 }
 
-// getNodesByTag return the names of the nodes having the given tag.
-func getNodesByTag(tag string) ([]string, error) {
-	files, err := ioutil.ReadDir(Directory + "/darknodes")
+// readPassphrase asks the user for a passphrase without echoing it.
+func readPassphrase(prompt string) (string, error) {
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return "", ErrNoTerminal
+	}
+	fmt.Print(prompt)
+	passphrase, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	nodes := []string{}
 
-	for _, f := range files {
-		tagFile := Directory + "/darknodes/" + f.Name() + "/tags.out"
-		tags, err := ioutil.ReadFile(tagFile)
-		if err != nil {
-			continue
-		}
-		if strings.Contains(string(tags), tag) {
-			nodes = append(nodes, f.Name())
-		}
+	return string(passphrase), nil
+}
+
+// flagPassphrase returns the passphrase given with --passphrase, or read from
+// the file given with --passphrase-file. It returns an empty passphrase if
+// neither is given, so the caller can ask for it.
+func flagPassphrase(ctx *cli.Context) (string, error) {
+	passphraseFile := ctx.String("passphrase-file")
+	if passphraseFile == "" {
+		return ctx.String("passphrase"), nil
+	}
+	if ctx.String("passphrase") != "" {
+		return "", ErrPassphraseAndFile
+	}
+	data, err := ioutil.ReadFile(passphraseFile)
+	if err != nil {
+		return "", err
 	}
 
-	return nodes, nil
+	return strings.TrimRight(string(data), "\r\n"), nil
 }
 
 // cleanUp removes the directory
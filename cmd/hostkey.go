@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ssh"
+)
+
+// trustedHostKey returns a callback which only accepts the host key pinned in
+// the directory of the Darknode with the given name.
+func trustedHostKey(name string) (ssh.HostKeyCallback, error) {
+	nodeDirectory := NodeDirectory(name)
+	pinned, err := readHostKey(nodeDirectory)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%shost key of [%s] is not trusted, run `darknode trust --name %s` to trust it%s", RED, name, name, RESET)
+		}
+		return nil, err
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if bytes.Equal(key.Marshal(), pinned.Marshal()) {
+			return nil
+		}
+		return fmt.Errorf("%shost key of [%s] has changed from %s to %s, someone could be eavesdropping on you. Run `darknode trust --name %s` only if you know why it changed%s",
+			RED, name, ssh.FingerprintSHA256(pinned), ssh.FingerprintSHA256(key), name, RESET)
+	}, nil
+}
+
+// recordHostKey returns a callback which accepts any host key and pins it in
+// the node directory. It must only be used for the first connection to a
+// server provisioned over ssh, as the host key of an existing server cannot be
+// generated by the CLI.
+func recordHostKey(nodeDirectory string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		return writeHostKey(nodeDirectory, key)
+	}
+}
+
+// hostKeyUserData is the cloud-init config which installs the host key
+// generated for a new Darknode, so the instance presents the pinned host key
+// from its first boot.
+const hostKeyUserData = `#cloud-config
+ssh_deletekeys: true
+ssh_genkeytypes: []
+ssh_keys:
+  ecdsa_private: |
+%s
+  ecdsa_public: %s
+`
+
+// newHostKey generates the host key of a new Darknode and pins it in the node
+// directory before the instance is created. The cloud-init config installing
+// the key is written to user_data.yml, which terraform passes to the instance
+// as its user data. It returns the public key, which terraform uses to verify
+// the connections of its provisioners.
+func newHostKey(nodeDirectory string) (string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	publicKey, err := ssh.NewPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	authorizedKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey)))
+
+	privatePEM := strings.TrimSpace(string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})))
+	userData := fmt.Sprintf(hostKeyUserData, "    "+strings.Replace(privatePEM, "\n", "\n    ", -1), authorizedKey)
+	if err := ioutil.WriteFile(nodeDirectory+"/user_data.yml", []byte(userData), 0600); err != nil {
+		return "", err
+	}
+	if err := writeHostKey(nodeDirectory, publicKey); err != nil {
+		return "", err
+	}
+
+	return authorizedKey, nil
+}
+
+// readHostKey reads the pinned host key from the node directory.
+func readHostKey(nodeDirectory string) (ssh.PublicKey, error) {
+	data, err := ioutil.ReadFile(nodeDirectory + "/host_key.pub")
+	if err != nil {
+		return nil, err
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	return key, err
+}
+
+// writeHostKey pins the host key in the node directory.
+func writeHostKey(nodeDirectory string, key ssh.PublicKey) error {
+	return ioutil.WriteFile(nodeDirectory+"/host_key.pub", ssh.MarshalAuthorizedKey(key), 0600)
+}
+
+// trustNode fetches the current host key of the Darknode and pins it once the
+// user has confirmed its fingerprint.
+func trustNode(ctx *cli.Context) error {
+	name := ctx.String("name")
+	force := ctx.Bool("force")
+	if name == "" {
+		cli.ShowCommandHelp(ctx, "trust")
+		return ErrEmptyNodeName
+	}
+	nodeDirectory := NodeDirectory(name)
+
+	var presented ssh.PublicKey
+	client, err := dialNode(name, func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		presented = key
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := client.Close(); err != nil {
+		return err
+	}
+
+	pinned, err := readHostKey(nodeDirectory)
+	if err == nil {
+		if bytes.Equal(pinned.Marshal(), presented.Marshal()) {
+			fmt.Printf("%sHost key of [%s] is already trusted.%s\n", GREEN, name, RESET)
+			return nil
+		}
+		fmt.Printf("Trusted host key of [%s]: %s %s\n", name, pinned.Type(), ssh.FingerprintSHA256(pinned))
+	}
+	fmt.Printf("Current host key of [%s]: %s %s\n", name, presented.Type(), ssh.FingerprintSHA256(presented))
+	if !force && !promptYesNo("Do you want to trust the current host key? (Yes/No)") {
+		return nil
+	}
+	if err := writeHostKey(nodeDirectory, presented); err != nil {
+		return err
+	}
+	fmt.Printf("%sHost key of [%s] is now trusted.%s\n", GREEN, name, RESET)
+
+	return nil
+}
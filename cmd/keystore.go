@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/republicprotocol/republic-go/crypto"
+	"github.com/republicprotocol/republic-go/identity"
+	"github.com/urfave/cli"
+)
+
+// importKeystore decrypts the Darknode keystore file, asking for the
+// passphrase if none is given. The address of the decrypted ECDSA key must
+// match the address stored in the file and the expected address, if one is
+// given.
+func importKeystore(keystoreFile, passphrase string, expected identity.Address) (crypto.Keystore, error) {
+	data, err := ioutil.ReadFile(keystoreFile)
+	if err != nil {
+		return crypto.Keystore{}, err
+	}
+	if passphrase == "" {
+		passphrase, err = readPassphrase("Passphrase of the Darknode keystore: ")
+		if err != nil {
+			return crypto.Keystore{}, err
+		}
+	}
+	keystore := crypto.Keystore{}
+	if err := keystore.DecryptFromJSON(data, passphrase); err != nil {
+		return crypto.Keystore{}, fmt.Errorf("%scannot decrypt the Darknode keystore: %v%s", RED, err, RESET)
+	}
+	if keystore.EcdsaKey.PrivateKey == nil || keystore.RsaKey.PrivateKey == nil {
+		return crypto.Keystore{}, ErrIncompleteKeystore
+	}
+
+	address := identity.Address(keystore.Address())
+	stored := struct {
+		Ecdsa struct {
+			Address identity.Address `json:"address"`
+		} `json:"ecdsa"`
+	}{}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return crypto.Keystore{}, err
+	}
+	if stored.Ecdsa.Address != "" && stored.Ecdsa.Address != address {
+		return crypto.Keystore{}, fmt.Errorf("%sthe keystore claims the address %v, but its key has the address %v%s", RED, stored.Ecdsa.Address, address, RESET)
+	}
+	if expected != "" && expected != address {
+		return crypto.Keystore{}, fmt.Errorf("%sthe keystore has the address %v, expected %v%s", RED, address, expected, RESET)
+	}
+
+	return keystore, nil
+}
+
+// exportKeystore writes the keystore of the Darknode encrypted with a new
+// passphrase, so the Darknode can be backed up or moved to another machine.
+func exportKeystore(ctx *cli.Context) error {
+	name := ctx.String("name")
+	output := ctx.String("output")
+	if name == "" {
+		cli.ShowCommandHelp(ctx, "export")
+		return ErrEmptyNodeName
+	}
+	cfg, err := loadConfig(name)
+	if err != nil {
+		return err
+	}
+	passphrase, err := flagPassphrase(ctx)
+	if err != nil {
+		return err
+	}
+	if passphrase == "" {
+		passphrase, err = readPassphrase("New passphrase of the exported keystore: ")
+		if err != nil {
+			return err
+		}
+		confirmation, err := readPassphrase("Repeat the passphrase: ")
+		if err != nil {
+			return err
+		}
+		if passphrase != confirmation {
+			return ErrPassphraseMismatch
+		}
+	}
+	if passphrase == "" {
+		return ErrEmptyPassphrase
+	}
+
+	data, err := cfg.Keystore.EncryptToJSON(passphrase, crypto.StandardScryptN, crypto.StandardScryptP)
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		_, err := fmt.Fprintln(os.Stdout, string(data))
+		return err
+	}
+	if err := ioutil.WriteFile(output, data, 0600); err != nil {
+		return err
+	}
+	fmt.Printf("%sThe keystore of [%s] has been exported to %v.%s\n", GREEN, name, output, RESET)
+
+	return nil
+}
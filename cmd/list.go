@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// listRow is a Darknode shown by the list command, together with its live
+// status if it has been probed.
+type listRow struct {
+	Node
+	Status NodeStatus
+}
+
+// listColumn is a column which can be shown by the list command.
+type listColumn struct {
+	name   string
+	value  func(row listRow) []string
+	list   bool
+	status bool
+}
+
+// listColumns contains all columns in the order they are shown.
+var listColumns = []listColumn{
+	{name: "name", value: func(row listRow) []string { return []string{row.Name} }},
+	{name: "address", value: func(row listRow) []string {
+		address, _ := row.Address()
+		return []string{address}
+	}},
+	{name: "ip", value: func(row listRow) []string { return []string{row.IP} }},
+	{name: "provider", value: func(row listRow) []string { return []string{row.Provider} }},
+	{name: "profile", value: func(row listRow) []string { return []string{row.Profile} }},
+	{name: "region", value: func(row listRow) []string { return []string{row.Region} }},
+	{name: "instance", value: func(row listRow) []string { return []string{row.Instance} }},
+	{name: "network", value: func(row listRow) []string { return []string{row.Network} }},
+	{name: "branch", value: func(row listRow) []string { return []string{row.Branch} }},
+	{name: "created", value: func(row listRow) []string { return []string{row.CreatedAt.UTC().Format(time.RFC3339)} }},
+	{name: "tags", value: func(row listRow) []string { return row.Tags }, list: true},
+	{name: "reachable", value: func(row listRow) []string { return []string{row.Status.Reachable} }, status: true},
+	{name: "service", value: func(row listRow) []string { return []string{row.Status.Service} }, status: true},
+	{name: "commit", value: func(row listRow) []string { return []string{row.Status.Commit} }, status: true},
+	{name: "peers", value: func(row listRow) []string { return []string{row.Status.Peers} }, status: true},
+	{name: "registration", value: func(row listRow) []string { return []string{row.Status.Registration} }, status: true},
+}
+
+// defaultTableColumns are the columns of the table when no columns are
+// given. Other formats show all columns by default.
+var defaultTableColumns = []string{"name", "address", "ip", "tags"}
+
+// defaultStatusTableColumns are the columns of the table when no columns are
+// given and the status of the Darknodes is requested.
+var defaultStatusTableColumns = []string{"name", "ip", "reachable", "service", "commit", "peers", "registration"}
+
+// listColumnNames returns the names of all columns.
+func listColumnNames() []string {
+	names := make([]string, len(listColumns))
+	for i, column := range listColumns {
+		names[i] = column.name
+	}
+
+	return names
+}
+
+// staticColumnNames returns the names of the columns which don't need the
+// Darknodes to be probed.
+func staticColumnNames() []string {
+	names := []string{}
+	for _, column := range listColumns {
+		if !column.status {
+			names = append(names, column.name)
+		}
+	}
+
+	return names
+}
+
+// findListColumn returns the column with the given name.
+func findListColumn(name string) (listColumn, error) {
+	for _, column := range listColumns {
+		if column.name == name {
+			return column, nil
+		}
+	}
+
+	return listColumn{}, fmt.Errorf("%sunknown column %q, columns are %s%s", RED, name, strings.Join(listColumnNames(), ", "), RESET)
+}
+
+// parseListColumns parses the comma separated column names.
+func parseListColumns(names []string) ([]listColumn, error) {
+	columns := []listColumn{}
+	for _, name := range names {
+		column, err := findListColumn(strings.ToLower(strings.TrimSpace(name)))
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+
+	return columns, nil
+}
+
+// listAllNodes prints the Darknodes selected by the tags in the requested
+// format. The Darknodes are probed for their live status if it is requested
+// or if any of the columns needs it.
+func listAllNodes(ctx *cli.Context) error {
+	output := strings.ToLower(ctx.String("output"))
+	quiet := ctx.Bool("quiet")
+	status := ctx.Bool("status")
+
+	nodes, err := selectNodes(ctx.StringSlice("tag"))
+	if err != nil {
+		return err
+	}
+
+	names := staticColumnNames()
+	switch {
+	case ctx.String("columns") != "":
+		names = strings.Split(ctx.String("columns"), ",")
+	case output == "table" && status:
+		names = defaultStatusTableColumns
+	case output == "table":
+		names = defaultTableColumns
+	case status:
+		names = listColumnNames()
+	}
+	columns, err := parseListColumns(names)
+	if err != nil {
+		return err
+	}
+	sortColumn, descending, err := parseSortColumn(ctx.String("sort"))
+	if err != nil {
+		return err
+	}
+	for _, column := range append(columns, sortColumn) {
+		status = status || column.status
+	}
+
+	rows := make([]listRow, len(nodes))
+	for i := range nodes {
+		rows[i].Node = nodes[i]
+	}
+	if status && !quiet && len(nodes) > 0 {
+		statuses := probeNodes(nodes, ctx.Duration("timeout"))
+		for i := range rows {
+			rows[i].Status = statuses[i]
+		}
+	}
+	sortRows(rows, sortColumn, descending)
+	if quiet {
+		for _, row := range rows {
+			fmt.Println(row.Name)
+		}
+		return nil
+	}
+
+	switch output {
+	case "table":
+		if len(rows) == 0 {
+			return fmt.Errorf("%scannot find any node%s", RED, RESET)
+		}
+		return writeTable(os.Stdout, rows, columns)
+	case "json":
+		return writeJSON(os.Stdout, rows, columns)
+	case "yaml":
+		return writeYAML(os.Stdout, rows, columns)
+	case "csv":
+		return writeCSV(os.Stdout, rows, columns)
+	default:
+		return fmt.Errorf("%sunknown output format %q, formats are table, json, yaml and csv%s", RED, output, RESET)
+	}
+}
+
+// parseSortColumn parses the column used for sorting. The order is
+// descending if the column is prefixed with "-".
+func parseSortColumn(by string) (listColumn, bool, error) {
+	descending := strings.HasPrefix(by, "-")
+	column, err := findListColumn(strings.ToLower(strings.TrimPrefix(by, "-")))
+
+	return column, descending, err
+}
+
+// sortRows sorts the Darknodes by the column. Ties are broken by the names of
+// the Darknodes.
+func sortRows(rows []listRow, column listColumn, descending bool) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		a := strings.Join(column.value(rows[i]), ",")
+		b := strings.Join(column.value(rows[j]), ",")
+		if a == b {
+			return rows[i].Name < rows[j].Name
+		}
+		return (a < b) != descending
+	})
+}
+
+// writeTable writes the Darknodes as a table.
+func writeTable(w io.Writer, rows []listRow, columns []listColumn) error {
+	table := [][]string{make([]string, len(columns))}
+	for i, column := range columns {
+		table[0][i] = column.name
+	}
+	for _, row := range rows {
+		cells := make([]string, len(columns))
+		for i, column := range columns {
+			cells[i] = strings.Join(column.value(row), ",")
+		}
+		table = append(table, cells)
+	}
+
+	return printTable(w, table)
+}
+
+// printTable prints the rows of cells with columns wide enough for their
+// longest values.
+func printTable(w io.Writer, table [][]string) error {
+	widths := []int{}
+	for _, cells := range table {
+		for i, value := range cells {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			if len(value) > widths[i] {
+				widths[i] = len(value)
+			}
+		}
+	}
+	for _, cells := range table {
+		padded := make([]string, len(cells))
+		for i, value := range cells {
+			padded[i] = fmt.Sprintf("%-*s", widths[i], value)
+		}
+		if _, err := fmt.Fprintln(w, strings.TrimRight(strings.Join(padded, " | "), " ")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeJSON writes the Darknodes as a JSON array of objects, keeping the
+// order of the columns.
+func writeJSON(w io.Writer, rows []listRow, columns []listColumn) error {
+	objects := make([]string, len(rows))
+	for i, row := range rows {
+		fields := make([]string, len(columns))
+		for j, column := range columns {
+			key, err := json.Marshal(column.name)
+			if err != nil {
+				return err
+			}
+			value, err := json.Marshal(columnValue(column, row))
+			if err != nil {
+				return err
+			}
+			fields[j] = fmt.Sprintf("        %s: %s", key, value)
+		}
+		objects[i] = "    {\n" + strings.Join(fields, ",\n") + "\n    }"
+	}
+	if len(objects) == 0 {
+		_, err := fmt.Fprintln(w, "[]")
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "[\n%s\n]\n", strings.Join(objects, ",\n"))
+	return err
+}
+
+// writeYAML writes the Darknodes as a YAML sequence of mappings. Strings are
+// written as double-quoted scalars, which share their escaping rules with
+// JSON strings.
+func writeYAML(w io.Writer, rows []listRow, columns []listColumn) error {
+	if len(rows) == 0 {
+		_, err := fmt.Fprintln(w, "[]")
+		return err
+	}
+	for _, row := range rows {
+		for i, column := range columns {
+			indent := "  "
+			if i == 0 {
+				indent = "- "
+			}
+			if !column.list {
+				value, err := json.Marshal(strings.Join(column.value(row), ","))
+				if err != nil {
+					return err
+				}
+				if _, err := fmt.Fprintf(w, "%s%s: %s\n", indent, column.name, value); err != nil {
+					return err
+				}
+				continue
+			}
+
+			values := column.value(row)
+			if len(values) == 0 {
+				if _, err := fmt.Fprintf(w, "%s%s: []\n", indent, column.name); err != nil {
+					return err
+				}
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "%s%s:\n", indent, column.name); err != nil {
+				return err
+			}
+			for _, value := range values {
+				data, err := json.Marshal(value)
+				if err != nil {
+					return err
+				}
+				if _, err := fmt.Fprintf(w, "  - %s\n", data); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// writeCSV writes the Darknodes as CSV with a header row. Lists are joined
+// with commas.
+func writeCSV(w io.Writer, rows []listRow, columns []listColumn) error {
+	writer := csv.NewWriter(w)
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.name
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			record[i] = strings.Join(column.value(row), ",")
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+
+	return writer.Error()
+}
+
+// columnValue returns the value of the column as a string, or as a list of
+// strings for list columns.
+func columnValue(column listColumn, row listRow) interface{} {
+	if column.list {
+		values := column.value(row)
+		if values == nil {
+			values = []string{}
+		}
+		return values
+	}
+
+	return strings.Join(column.value(row), ",")
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testRows returns the Darknodes used to test the output formats.
+func testRows(t *testing.T) []listRow {
+	t.Helper()
+	first := Node{
+		Name:      "node-1",
+		Provider:  "aws",
+		Region:    "eu-west-1",
+		Network:   "testnet",
+		CreatedAt: time.Date(2018, 7, 1, 12, 0, 0, 0, time.UTC),
+		Tags:      []string{"canary", "region=eu"},
+	}
+	if err := first.SetMultiAddress(bundledNetwork(t, "testnet").BootstrapMultiAddresses[0]); err != nil {
+		t.Fatal(err)
+	}
+	second := Node{
+		Name:      `node "2", b`,
+		Provider:  "server",
+		Network:   "testnet",
+		CreatedAt: time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	return []listRow{
+		{Node: first, Status: NodeStatus{Reachable: "yes"}},
+		{Node: second, Status: NodeStatus{Reachable: "no"}},
+	}
+}
+
+func testColumns(t *testing.T, names ...string) []listColumn {
+	t.Helper()
+	columns, err := parseListColumns(names)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return columns
+}
+
+func TestWriteTable(t *testing.T) {
+	rows := testRows(t)
+	buf := new(bytes.Buffer)
+	if err := writeTable(buf, rows, testColumns(t, "name", "ip", "tags")); err != nil {
+		t.Fatal(err)
+	}
+	ip := rows[0].IP
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	width := len(`node "2", b`)
+	expected := []string{
+		"name" + strings.Repeat(" ", width-len("name")) + " | ip" + strings.Repeat(" ", len(ip)-len("ip")) + " | tags",
+		"node-1" + strings.Repeat(" ", width-len("node-1")) + " | " + ip + " | canary,region=eu",
+		`node "2", b` + " | " + strings.Repeat(" ", len(ip)) + " |",
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d lines, got %q", len(expected), buf.String())
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("line %d: expected %q, got %q", i, expected[i], lines[i])
+		}
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	rows := testRows(t)
+	tests := []struct {
+		rows    []listRow
+		columns []string
+	}{
+		{rows, []string{"name", "address", "tags", "created"}},
+		{rows, []string{"tags", "name", "reachable"}},
+		{[]listRow{}, []string{"name"}},
+	}
+	for _, test := range tests {
+		buf := new(bytes.Buffer)
+		if err := writeJSON(buf, test.rows, testColumns(t, test.columns...)); err != nil {
+			t.Fatal(err)
+		}
+		objects := []map[string]interface{}{}
+		if err := json.Unmarshal(buf.Bytes(), &objects); err != nil {
+			t.Fatalf("%v: invalid JSON %q: %v", test.columns, buf.String(), err)
+		}
+		if len(objects) != len(test.rows) {
+			t.Fatalf("%v: expected %d objects, got %d", test.columns, len(test.rows), len(objects))
+		}
+		for i, object := range objects {
+			if len(object) != len(test.columns) {
+				t.Errorf("%v: expected the keys %v, got %v", test.columns, test.columns, object)
+			}
+			if object["name"] != test.rows[i].Name {
+				t.Errorf("%v: expected the name %q, got %v", test.columns, test.rows[i].Name, object["name"])
+			}
+			if tags, ok := object["tags"]; ok {
+				// Tags are always an array, even if the Darknode has none.
+				list, ok := tags.([]interface{})
+				if !ok || len(list) != len(test.rows[i].Tags) {
+					t.Errorf("%v: expected the tags %v, got %v", test.columns, test.rows[i].Tags, tags)
+				}
+			}
+		}
+
+		// The keys are written in the order of the columns.
+		previous := -1
+		for _, column := range test.columns {
+			if len(test.rows) == 0 {
+				break
+			}
+			index := strings.Index(buf.String(), `"`+column+`":`)
+			if index < previous {
+				t.Errorf("%v: expected the key %q to follow the previous column", test.columns, column)
+			}
+			previous = index
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := writeJSON(buf, rows, testColumns(t, "address", "created")); err != nil {
+		t.Fatal(err)
+	}
+	objects := []map[string]string{}
+	if err := json.Unmarshal(buf.Bytes(), &objects); err != nil {
+		t.Fatal(err)
+	}
+	address, err := rows[0].Address()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if objects[0]["address"] != address || objects[1]["address"] != "" {
+		t.Errorf("expected the addresses %q and \"\", got %v", address, objects)
+	}
+	if objects[0]["created"] != "2018-07-01T12:00:00Z" {
+		t.Errorf("expected the creation time in RFC 3339, got %q", objects[0]["created"])
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	rows := testRows(t)
+	buf := new(bytes.Buffer)
+	if err := writeCSV(buf, rows, testColumns(t, "name", "provider", "tags")); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{
+		{"name", "provider", "tags"},
+		{"node-1", "aws", "canary,region=eu"},
+		{`node "2", b`, "server", ""},
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, records)
+	}
+	for i := range expected {
+		if strings.Join(records[i], "|") != strings.Join(expected[i], "|") {
+			t.Errorf("record %d: expected %q, got %q", i, expected[i], records[i])
+		}
+	}
+}
+
+func TestWriteYAML(t *testing.T) {
+	rows := testRows(t)
+	buf := new(bytes.Buffer)
+	if err := writeYAML(buf, rows, testColumns(t, "name", "tags")); err != nil {
+		t.Fatal(err)
+	}
+	expected := `- name: "node-1"
+  tags:
+  - "canary"
+  - "region=eu"
+- name: "node \"2\", b"
+  tags: []
+`
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	if err := writeYAML(buf, nil, testColumns(t, "name")); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "[]\n" {
+		t.Errorf("expected an empty sequence, got %q", buf.String())
+	}
+}
+
+func TestParseListColumns(t *testing.T) {
+	tests := []struct {
+		names []string
+		valid bool
+	}{
+		{[]string{"name", " IP ", "Tags"}, true},
+		{listColumnNames(), true},
+		{[]string{"name", "unknown"}, false},
+		{[]string{""}, false},
+	}
+	for _, test := range tests {
+		columns, err := parseListColumns(test.names)
+		if test.valid != (err == nil) {
+			t.Errorf("%q: unexpected error %v", test.names, err)
+			continue
+		}
+		if test.valid && len(columns) != len(test.names) {
+			t.Errorf("%q: expected %d columns, got %d", test.names, len(test.names), len(columns))
+		}
+	}
+}
+
+func TestSortRows(t *testing.T) {
+	tests := []struct {
+		by    string
+		names []string
+	}{
+		{"name", []string{`node "2", b`, "node-1"}},
+		{"-name", []string{"node-1", `node "2", b`}},
+		{"created", []string{`node "2", b`, "node-1"}},
+		{"-reachable", []string{"node-1", `node "2", b`}},
+	}
+	for _, test := range tests {
+		rows := testRows(t)
+		column, descending, err := parseSortColumn(test.by)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sortRows(rows, column, descending)
+		if rows[0].Name != test.names[0] || rows[1].Name != test.names[1] {
+			t.Errorf("sorting by %v: expected %q, got %q and %q", test.by, test.names, rows[0].Name, rows[1].Name)
+		}
+	}
+	if _, _, err := parseSortColumn("unknown"); err == nil {
+		t.Error("expected an error for an unknown sort column")
+	}
+}
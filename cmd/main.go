@@ -2,14 +2,12 @@ package main
 
 import (
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
 	"path"
 	"strings"
+	"time"
 
-	"github.com/republicprotocol/republic-go/identity"
 	"github.com/urfave/cli"
 )
 
@@ -28,15 +26,24 @@ func main() {
 		Name:  "name",
 		Usage: "A unique human-readable `string` for identifying the Darknode",
 	}
-	tagFlag := cli.StringFlag{
+	tagFlag := cli.StringSliceFlag{
 		Name:  "tag",
-		Usage: "A human-readable `string` for identifying groups of Darknodes",
+		Usage: "Select Darknodes by their tags, e.g. `region=eu,!canary`. Comma separated tags must all match, repeated flags match any of them",
 	}
 	tagsFlag := cli.StringFlag{
 		Name:  "tags",
 		Usage: "Multiple human-readable comma separated `strings` for identifying groups of Darknodes",
 	}
 
+	passphraseFlag := cli.StringFlag{
+		Name:  "passphrase",
+		Usage: "An optional `secret` for decrypting the keystore file, you will be asked for it if not given",
+	}
+	passphraseFileFlag := cli.StringFlag{
+		Name:  "passphrase-file",
+		Usage: "A `file` containing the passphrase, which keeps it out of your shell history",
+	}
+
 	// Flag for each command
 	upFlags := []cli.Flag{
 		nameFlag, tagsFlag,
@@ -44,9 +51,10 @@ func main() {
 			Name:  "keystore",
 			Usage: "An optional keystore `file` that will be used for the Darknode",
 		},
+		passphraseFlag, passphraseFileFlag,
 		cli.StringFlag{
-			Name:  "passphrase",
-			Usage: "An optional `secret` for decrypting the keystore file",
+			Name:  "address",
+			Usage: "The expected Republic `address` of the keystore file",
 		},
 		cli.StringFlag{
 			Name:  "config",
@@ -55,42 +63,14 @@ func main() {
 		cli.StringFlag{
 			Name:  "network",
 			Value: "testnet",
-			Usage: "Darkpool network of your node",
-		},
-
-		// AWS flags
-		cli.BoolFlag{
-			Name:  "aws",
-			Usage: "AWS will be used to provision the Darknode",
-		},
-		cli.StringFlag{
-			Name:  "aws-access-key",
-			Usage: "AWS access `key` for programmatic access",
-		},
-		cli.StringFlag{
-			Name:  "aws-secret-key",
-			Usage: "AWS secret `key` for programmatic access",
-		},
-		cli.StringFlag{
-			Name:  "aws-region",
-			Usage: "An optional AWS region (default: random)",
-		},
-		cli.StringFlag{
-			Name:  "aws-instance",
-			Value: "t2.medium",
-			Usage: "An optional AWS EC2 instance type",
+			Usage: "Darkpool `network` of your node, see `darknode network list`",
 		},
 		cli.StringFlag{
-			Name:  "aws-elastic-ip",
-			Usage: "An optional allocation ID for an elastic IP address",
-		},
-
-		// Digital Ocean flags
-		cli.BoolFlag{
-			Name:  "digitalocean",
-			Usage: "Digital Ocean will be used to provision the Darknode",
+			Name:  "profile",
+			Usage: "The credential `profile` used to deploy and later manage the Darknode, see `darknode credentials list`",
 		},
 	}
+	upFlags = append(upFlags, providerFlags()...)
 
 	updateFlags := []cli.Flag{
 		nameFlag, tagFlag,
@@ -109,10 +89,102 @@ func main() {
 		nameFlag,
 		cli.BoolFlag{
 			Name:  "force, f",
-			Usage: "Force destruction without interactive prompts",
+			Usage: "Force destruction without checking the registration and without interactive prompts",
+		},
+	}
+
+	sshFlags := []cli.Flag{
+		nameFlag,
+		cli.BoolFlag{
+			Name:  "tty, t",
+			Usage: "Allocate a pseudo terminal for the command",
+		},
+		cli.BoolFlag{
+			Name:  "forward-agent, A",
+			Usage: "Forward your ssh agent to the Darknode",
+		},
+	}
+
+	resizeFlags := []cli.Flag{
+		nameFlag,
+		cli.StringFlag{
+			Name:  "instance",
+			Usage: "The new instance `type` of the Darknode",
 		},
 	}
 
+	ownerFlags := []cli.Flag{
+		nameFlag,
+		cli.StringFlag{
+			Name:  "keystore",
+			Usage: "The Ethereum keystore `file` of the owner of the Darknode",
+		},
+		passphraseFlag, passphraseFileFlag,
+	}
+
+	pollFlag := cli.DurationFlag{
+		Name:  "poll",
+		Value: time.Minute,
+		Usage: "How often to check the current epoch while waiting",
+	}
+	deregisterFlags := append([]cli.Flag{
+		cli.BoolFlag{
+			Name:  "wait-refund",
+			Usage: "Wait in the foreground and refund the bond as soon as it becomes refundable",
+		},
+		pollFlag,
+	}, ownerFlags...)
+	refundFlags := append([]cli.Flag{
+		cli.BoolFlag{
+			Name:  "pending",
+			Usage: "Refund the bonds of all Darknodes with a pending refund",
+		},
+	}, ownerFlags...)
+
+	listFlags := []cli.Flag{
+		tagFlag,
+		cli.StringFlag{
+			Name:  "output, o",
+			Value: "table",
+			Usage: "Output `format` of the list, one of table, json, yaml or csv",
+		},
+		cli.StringFlag{
+			Name:  "columns",
+			Usage: "Comma separated `columns` to show, from " + strings.Join(listColumnNames(), ", "),
+		},
+		cli.StringFlag{
+			Name:  "sort",
+			Value: "name",
+			Usage: "The `column` used to sort the Darknodes, prefix it with - for descending order",
+		},
+		cli.BoolFlag{
+			Name:  "quiet, q",
+			Usage: "Only print the names of the Darknodes",
+		},
+		cli.BoolFlag{
+			Name:  "status, s",
+			Usage: "Probe the Darknodes for their live status",
+		},
+		cli.DurationFlag{
+			Name:  "timeout",
+			Value: 10 * time.Second,
+			Usage: "Maximum `duration` to wait for each Darknode when probing its status",
+		},
+	}
+
+	balanceFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:  "name",
+			Usage: "Name of the Darknode to show, instead of selecting Darknodes by their tags",
+		},
+		tagFlag,
+	}
+
+	profileNameFlag := cli.StringFlag{
+		Name:  "name",
+		Usage: "The `name` of the credential profile",
+	}
+
 	// Define sub-commands
 	app.Commands = []cli.Command{
 		{
@@ -141,13 +213,22 @@ func main() {
 			},
 		},
 		{
-			Name:  "ssh",
-			Flags: []cli.Flag{nameFlag},
-			Usage: "SSH into one of your Darknode",
+			Name:      "ssh",
+			Flags:     sshFlags,
+			Usage:     "SSH into one of your Darknode",
+			ArgsUsage: "[-- command]",
 			Action: func(c *cli.Context) error {
 				return sshNode(c)
 			},
 		},
+		{
+			Name:  "trust",
+			Flags: []cli.Flag{nameFlag, cli.BoolFlag{Name: "force, f", Usage: "Trust the current host key without interactive prompts"}},
+			Usage: "Trust the current ssh host key of one of your Darknodes",
+			Action: func(c *cli.Context) error {
+				return trustNode(c)
+			},
+		},
 		{
 			Name:  "start",
 			Flags: []cli.Flag{nameFlag},
@@ -164,14 +245,259 @@ func main() {
 				return stopNode(c)
 			},
 		},
+		{
+			Name:  "resize",
+			Flags: resizeFlags,
+			Usage: "Change the instance type of one of your Darknodes",
+			Action: func(c *cli.Context) error {
+				return resizeNode(c)
+			},
+		},
+		{
+			Name:  "register",
+			Flags: ownerFlags,
+			Usage: "Register one of your Darknodes by bonding REN from the owner",
+			Action: func(c *cli.Context) error {
+				return registerNode(c)
+			},
+		},
+		{
+			Name:  "deregister",
+			Flags: deregisterFlags,
+			Usage: "Deregister one of your Darknodes",
+			Action: func(c *cli.Context) error {
+				return deregisterNode(c)
+			},
+		},
+		{
+			Name:  "refund",
+			Flags: refundFlags,
+			Usage: "Refund the bond of one of your deregistered Darknodes to the owner",
+			Action: func(c *cli.Context) error {
+				return refundNode(c)
+			},
+		},
+		{
+			Name:  "tag",
+			Usage: "Add or remove tags of one of your Darknodes",
+			Subcommands: []cli.Command{
+				{
+					Name:      "add",
+					Usage:     "Add tags to the Darknode",
+					ArgsUsage: "tag...",
+					Flags:     []cli.Flag{nameFlag},
+					Action: func(c *cli.Context) error {
+						return tagNode(c)
+					},
+				},
+				{
+					Name:      "remove",
+					Usage:     "Remove tags from the Darknode",
+					ArgsUsage: "tag...",
+					Flags:     []cli.Flag{nameFlag},
+					Action: func(c *cli.Context) error {
+						return untagNode(c)
+					},
+				},
+			},
+		},
 		{
 			Name:  "list",
 			Usage: "List all of your Darknodes",
-			Flags: []cli.Flag{tagFlag},
+			Flags: listFlags,
 			Action: func(c *cli.Context) error {
 				return listAllNodes(c)
 			},
 		},
+		{
+			Name:  "balance",
+			Usage: "Show the bonds, owners, pods and pending fees of your Darknodes",
+			Flags: balanceFlags,
+			Action: func(c *cli.Context) error {
+				return balanceNodes(c)
+			},
+		},
+		{
+			Name:  "config",
+			Usage: "Manage the configuration of your Darknodes",
+			Subcommands: []cli.Command{
+				{
+					Name:  "refresh-bootstrap",
+					Usage: "Update the bootstrap multiAddresses of your Darknodes from the definition of their network and restart them",
+					Flags: []cli.Flag{
+						nameFlag, tagFlag,
+						cli.BoolFlag{
+							Name:  "yes, y",
+							Usage: "Push the changes without asking for confirmation",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						return refreshBootstrap(c)
+					},
+				},
+				{
+					Name:      "get",
+					Usage:     "Print a key of the local config of the Darknode, e.g. `ethereum.uri`",
+					ArgsUsage: "[key]",
+					Flags:     []cli.Flag{nameFlag},
+					Action: func(c *cli.Context) error {
+						return getConfig(c)
+					},
+				},
+				{
+					Name:      "set",
+					Usage:     "Set a key of the local config of the Darknode after validating the new config",
+					ArgsUsage: "key value",
+					Flags:     []cli.Flag{nameFlag},
+					Action: func(c *cli.Context) error {
+						return setConfig(c)
+					},
+				},
+				{
+					Name:  "rollback",
+					Usage: "Restore the config the Darknode had before the last push and restart it",
+					Flags: []cli.Flag{nameFlag},
+					Action: func(c *cli.Context) error {
+						return rollbackConfig(c)
+					},
+				},
+				{
+					Name:  "diff",
+					Usage: "Show the differences between the config on the Darknode and the local config",
+					Flags: []cli.Flag{nameFlag},
+					Action: func(c *cli.Context) error {
+						return diffConfig(c)
+					},
+				},
+			},
+		},
+		{
+			Name:  "keystore",
+			Usage: "Export the keystores of your Darknodes",
+			Subcommands: []cli.Command{
+				{
+					Name:  "export",
+					Usage: "Write the keystore of the Darknode encrypted with a new passphrase",
+					Flags: []cli.Flag{
+						nameFlag, passphraseFileFlag,
+						cli.StringFlag{
+							Name:  "output, o",
+							Usage: "The `file` to write the keystore to, instead of the standard output",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						return exportKeystore(c)
+					},
+				},
+			},
+		},
+		{
+			Name:  "credentials",
+			Usage: "Manage named credential profiles for the accounts of cloud providers",
+			Subcommands: []cli.Command{
+				{
+					Name:  "add",
+					Usage: "Store the credentials of an account as a named profile",
+					Flags: append([]cli.Flag{profileNameFlag}, credentialsFlags()...),
+					Action: func(c *cli.Context) error {
+						return addProfile(c)
+					},
+				},
+				{
+					Name:  "list",
+					Usage: "List the profiles without their secrets",
+					Action: func(c *cli.Context) error {
+						return listProfiles(c)
+					},
+				},
+				{
+					Name:  "remove",
+					Usage: "Remove a profile",
+					Flags: append([]cli.Flag{
+						profileNameFlag,
+						cli.BoolFlag{
+							Name:  "force, f",
+							Usage: "Remove the profile even if Darknodes still use it",
+						},
+					}, providerSelectionFlags()...),
+					Action: func(c *cli.Context) error {
+						return removeProfile(c)
+					},
+				},
+			},
+		},
+		{
+			Name:  "vault",
+			Usage: "Encrypt the secrets of your Darknodes with a master passphrase",
+			Subcommands: []cli.Command{
+				{
+					Name:  "lock",
+					Usage: "Encrypt the configs, ssh keys and terraform configs of all Darknodes",
+					Flags: []cli.Flag{passphraseFileFlag},
+					Action: func(c *cli.Context) error {
+						return lockVault(c)
+					},
+				},
+				{
+					Name:  "unlock",
+					Usage: "Decrypt the secrets of all Darknodes and remove the vault",
+					Action: func(c *cli.Context) error {
+						return unlockVaultFiles(c)
+					},
+				},
+				{
+					Name:  "rotate",
+					Usage: "Change the passphrase of the vault",
+					Flags: []cli.Flag{passphraseFileFlag},
+					Action: func(c *cli.Context) error {
+						return rotateVault(c)
+					},
+				},
+			},
+		},
+		{
+			Name:  "network",
+			Usage: "List, show or add the Darkpool networks Darknodes can be deployed to",
+			Subcommands: []cli.Command{
+				{
+					Name:  "list",
+					Usage: "List the known networks",
+					Action: func(c *cli.Context) error {
+						return listNetworks(c)
+					},
+				},
+				{
+					Name:      "show",
+					Usage:     "Show the definition of a network",
+					ArgsUsage: "name",
+					Action: func(c *cli.Context) error {
+						return showNetwork(c)
+					},
+				},
+				{
+					Name:      "add",
+					Usage:     "Add a network defined in a JSON file",
+					ArgsUsage: "file",
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "force",
+							Usage: "Replace an existing network with the same name",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						return addNetwork(c)
+					},
+				},
+				{
+					Name:  "local",
+					Usage: "Set the Ethereum node, the contracts and the bootstrap Darknodes of the local network",
+					Flags: configureLocalNetworkFlags(),
+					Action: func(c *cli.Context) error {
+						return configureLocalNetwork(c)
+					},
+				},
+			},
+		},
 	}
 
 	// Show error message and display the help page for the app
@@ -189,110 +515,72 @@ func main() {
 	}
 }
 
-// listAllNodes will ssh into the Darknode
-func listAllNodes(ctx *cli.Context) error {
-	tag := ctx.String("tag")
-
-	files, err := ioutil.ReadDir(Directory + "/darknodes")
+// startNode starts a node by its name
+func startNode(ctx *cli.Context) error {
+	name := ctx.String("name")
+	if name == "" {
+		cli.ShowCommandHelp(ctx, "start")
+		return ErrEmptyNodeName
+	}
+	provider, err := nodeProvider(name)
 	if err != nil {
 		return err
 	}
-	nodes := [][]string{}
-
-	for _, f := range files {
-		tagFile := Directory + "/darknodes/" + f.Name() + "/tags.out"
-		tags, err := ioutil.ReadFile(tagFile)
-		if err != nil {
-			continue
-		}
-		if !strings.Contains(string(tags), tag) {
-			continue
-		}
-
-		addressFile := Directory + "/darknodes/" + f.Name() + "/multiAddress.out"
-		data, err := ioutil.ReadFile(addressFile)
-		if err != nil {
-			continue
-		}
-		multi, err := identity.NewMultiAddressFromString(strings.TrimSpace(string(data)))
-		if err != nil {
-			continue
-		}
-		address, err := multi.ValueForProtocol(identity.RepublicCode)
-		if err != nil {
-			continue
-		}
-		ip, err := multi.ValueForProtocol(identity.IP4Code)
-		if err != nil {
-			continue
-		}
-
-		nodes = append(nodes, []string{f.Name(), address, ip, string(tags)})
-	}
-
-	if len(nodes) == 0 {
-		return fmt.Errorf("%scannot find any node%s", RED, RESET)
-	} else {
-		fmt.Printf("%-20s | %-30s | %-15s | %-20s \n", "name", "Address", "ip", "tags")
-		for i := range nodes {
-			fmt.Printf("%-20s | %-30s | %-15s | %-20s \n", nodes[i][0], nodes[i][1], nodes[i][2], nodes[i][3])
-		}
+	if err := provider.Start(name); err != nil {
+		return err
 	}
+	fmt.Printf("%s[%s] has been turned on.%s \n", GREEN, name, RESET)
 
 	return nil
 }
 
-// startNode starts a node by its name
-func startNode(ctx *cli.Context) error {
+// stopNode stops a node by its name
+func stopNode(ctx *cli.Context) error {
 	name := ctx.String("name")
 	if name == "" {
-		cli.ShowCommandHelp(ctx, "start")
+		cli.ShowCommandHelp(ctx, "stop")
 		return ErrEmptyNodeName
 	}
-	nodeDirectory := Directory + "/darknodes/" + name
-	ip, err := getIp(nodeDirectory)
+	provider, err := nodeProvider(name)
 	if err != nil {
 		return err
 	}
-	startScript := "sudo systemctl start darknode"
-	keyPairPath := nodeDirectory + "/ssh_keypair"
-	startCmd := exec.Command("ssh", "-i", keyPairPath, "ubuntu@"+ip, "-oStrictHostKeyChecking=no", startScript)
-	pipeToStd(startCmd)
-	if err := startCmd.Start(); err != nil {
+	if err := provider.Stop(name); err != nil {
 		return err
 	}
-	if err := startCmd.Wait(); err != nil {
-		return err
-	}
-	fmt.Printf("%s[%s] has been turned on.%s \n", GREEN, name, RESET)
+	fmt.Printf("%s[%s] has been turned off.%s \n", GREEN, name, RESET)
 
 	return nil
 }
 
-// stopNode stops a node by its name
-func stopNode(ctx *cli.Context) error {
-
+// resizeNode changes the instance type of a node by its name
+func resizeNode(ctx *cli.Context) error {
 	name := ctx.String("name")
+	instance := strings.ToLower(ctx.String("instance"))
 	if name == "" {
-		cli.ShowCommandHelp(ctx, "stop")
+		cli.ShowCommandHelp(ctx, "resize")
 		return ErrEmptyNodeName
 	}
-	nodeDirectory := Directory + "/darknodes/" + name
-	ip, err := getIp(nodeDirectory)
+	if instance == "" {
+		cli.ShowCommandHelp(ctx, "resize")
+		return ErrEmptyInstanceType
+	}
+	provider, err := nodeProvider(name)
 	if err != nil {
 		return err
 	}
-	stopScript := "sudo systemctl stop darknode"
-	keyPairPath := nodeDirectory + "/ssh_keypair"
-	stopCmd := exec.Command("ssh", "-i", keyPairPath, "ubuntu@"+ip, "-oStrictHostKeyChecking=no", stopScript)
-	pipeToStd(stopCmd)
-	if err := stopCmd.Start(); err != nil {
+	if err := provider.Resize(name, instance); err != nil {
 		return err
 	}
-	if err := stopCmd.Wait(); err != nil {
+	node, err := LoadNode(name)
+	if err != nil {
 		return err
 	}
-	fmt.Printf("%s[%s] has been turned off.%s \n", GREEN, name, RESET)
+	node.Instance = instance
+	if err := SaveNode(node); err != nil {
+		return err
+	}
+	fmt.Printf("%s[%s] has been resized to %s.%s \n", GREEN, name, instance, RESET)
 
 	return nil
 }
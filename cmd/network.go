@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/republicprotocol/republic-go/contract"
+	"github.com/republicprotocol/republic-go/identity"
+	"github.com/urfave/cli"
+)
+
+// Network defines a Darkpool network which Darknodes can be deployed to.
+type Network struct {
+	Name string `json:"name"`
+
+	// Branch is the branch of republic-go run by the Darknodes.
+	Branch string `json:"branch"`
+
+	// Port is the default port of the Darknodes.
+	Port string `json:"port"`
+
+	// BootstrapMultiAddresses are the Darknodes used to join the network.
+	BootstrapMultiAddresses []string `json:"bootstrapMultiAddresses"`
+
+	// Ethereum contains the Ethereum URI and the addresses of the contracts
+	// of the network.
+	Ethereum contract.Config `json:"ethereum"`
+
+	// Source is where the network has been defined, either "bundled" or the
+	// path of its file.
+	Source string `json:"-"`
+}
+
+// validNetworkName matches the names of networks, which are also used as the
+// names of their files.
+var validNetworkName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// bundledNetworks are the networks known to this release of the CLI. They
+// can be overridden by files in the networks directory with the same name.
+// The mainnet is not bundled until its contracts are final, and has to be
+// added with `darknode network add`.
+var bundledNetworks = []Network{
+	{
+		Name:   "local",
+		Branch: "develop",
+		Port:   "18514",
+		Ethereum: contract.Config{
+			Network: contract.NetworkLocal,
+			URI:     "http://localhost:8545",
+		},
+	},
+	{
+		Name:   "testnet",
+		Branch: "develop",
+		Port:   "18514",
+		BootstrapMultiAddresses: []string{
+			"/ip4/54.250.246.106/tcp/18514/republic/8MJY6fvSCBCi3ujBqzTNTUkfF7WhFN",
+			"/ip4/13.209.15.151/tcp/18514/republic/8MGLgu2wx8h5iiZDVLsgKLhTXqP7Uj",
+			"/ip4/34.203.9.146/tcp/18514/republic/8MJBssiB8aT6pGAM6MYj7YNUJTgxt7",
+			"/ip4/34.245.26.34/tcp/18514/republic/8MG9AZnq9s8UGqUcMMeq3r7azc58Mk",
+			"/ip4/54.233.183.222/tcp/18514/republic/8MJ4LffVe6hDAha7AfKRt8Hr12xrVR",
+		},
+		Ethereum: contract.Config{
+			Network:                 contract.NetworkTestnet,
+			URI:                     "https://kovan.infura.io",
+			RepublicTokenAddress:    "0x6f429121a3bd3e6c1c17edbc676eec44cf117faf",
+			DarknodeRegistryAddress: "0x5d09eb34ce084bece690651f147dbd8ff41007bf",
+			OrderbookAddress:        "0xB01219Cf49e92ffcd48fecC96241dBd1372B8Bb1",
+			RewardVaultAddress:      "0x5d62ccc1086f38286dc152962a4f3e337eec1ec1",
+			RenExBalancesAddress:    "0xc5b98949AB0dfa0A7d4c07Bb29B002D6d6DA3e25",
+			RenExSettlementAddress:  "0xc53abbc5713e606a86533088707e80fcae33eff8",
+		},
+	},
+	{
+		Name:   "falcon",
+		Branch: "develop",
+		Port:   "18514",
+		BootstrapMultiAddresses: []string{
+			"/ip4/13.124.184.167/tcp/18514/republic/8MJw8s6TVKmQH3kdM5kJUYqPmh3JmF",
+			"/ip4/52.79.235.44/tcp/18514/republic/8MJEFcsQ5G8XMg5vka1XhswQotjbbj",
+			"/ip4/13.114.234.59/tcp/18514/republic/8MKKUenZG8inoZqd8boYxGb1J3waAg",
+			"/ip4/35.154.181.5/tcp/18514/republic/8MJNi8mgfQqD52bjUCnUzJ64uneJbk",
+		},
+		Ethereum: contract.Config{
+			Network:                 contract.NetworkFalcon,
+			URI:                     "https://kovan.infura.io",
+			RepublicTokenAddress:    "0x87e83f957a2f3a2e5fe16d5c6b22e38fd28bdc06",
+			DarknodeRegistryAddress: "0x7352e7244899b7cb5d803cc02741c8910d3b75de",
+			OrderbookAddress:        "0x20949251119d77471a40f456a8a9d39b1847db8d",
+			RewardVaultAddress:      "0x0e6bbbb35835cc3624a000e1698b7b68e9eec7df",
+			RenExBalancesAddress:    "0x3083e5ba36c6b42ca93c22c803013a4539eedc7f",
+			RenExSettlementAddress:  "0x038b63c120a7e60946d6ebaa6dcfc3a475108cc9",
+		},
+	},
+	{
+		Name:   "nightly",
+		Branch: "nightly",
+		Port:   "18514",
+		BootstrapMultiAddresses: []string{
+			"/ip4/54.255.182.246/tcp/18514/republic/8MHgRa2Uj7Tj2cgoA1PoULso7UmgVi",
+			"/ip4/52.62.18.91/tcp/18514/republic/8MJnjSUVJCgP6YVjNWzaJXtiKE3p1o",
+		},
+		Ethereum: contract.Config{
+			Network:                 contract.NetworkNightly,
+			URI:                     "https://kovan.infura.io",
+			RepublicTokenAddress:    "0x15f692d6b9ba8cec643c7d16909e8acdec431bf6",
+			DarknodeRegistryAddress: "0xc735241f93f87d4dbea499ee6e1d41ec50e3d8ce",
+			OrderbookAddress:        "0x42c72b4090ed0627c85ed878f699b2db254beeca",
+			RewardVaultAddress:      "0x65129f15fc0bfd901ce99c71147a93256fa094e6",
+			RenExBalancesAddress:    "0x6268002a734edcde6c2111ae339e0d92b1ed2bfa",
+			RenExSettlementAddress:  "0xd42f9dd5e66627aa836b206edd76025b26a89dea",
+		},
+	},
+}
+
+// NetworksDirectory returns the directory containing the user defined
+// networks, one JSON file per network.
+func NetworksDirectory() string {
+	return Directory + "/networks.d"
+}
+
+// LoadNetworks returns the bundled networks and the networks defined in the
+// networks directory, sorted by name. Invalid network files are skipped with
+// a warning.
+func LoadNetworks() ([]Network, error) {
+	networks := map[string]Network{}
+	for _, network := range bundledNetworks {
+		network.Source = "bundled"
+		networks[network.Name] = network
+	}
+
+	files, err := filepath.Glob(NetworksDirectory() + "/*.json")
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		network, err := readNetworkFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%sskipping %v: %v%s\n", RED, file, err, RESET)
+			continue
+		}
+		networks[network.Name] = network
+	}
+
+	list := make([]Network, 0, len(networks))
+	for _, network := range networks {
+		list = append(list, network)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	return list, nil
+}
+
+// LoadNetwork returns the network with the given name.
+func LoadNetwork(name string) (Network, error) {
+	networks, err := LoadNetworks()
+	if err != nil {
+		return Network{}, err
+	}
+	names := make([]string, len(networks))
+	for i, network := range networks {
+		if network.Name == name {
+			return network, nil
+		}
+		names[i] = network.Name
+	}
+
+	if contract.Network(name) == contract.NetworkMainnet {
+		return Network{}, ErrNoMainnet
+	}
+
+	return Network{}, fmt.Errorf("%sunknown network %q, networks are %s%s", RED, name, strings.Join(names, ", "), RESET)
+}
+
+// readNetworkFile reads and validates the network defined in the file. The
+// name of the file must match the name of the network.
+func readNetworkFile(file string) (Network, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return Network{}, err
+	}
+	network := Network{}
+	if err := json.Unmarshal(data, &network); err != nil {
+		return Network{}, err
+	}
+	if name := strings.TrimSuffix(filepath.Base(file), ".json"); name != network.Name {
+		return Network{}, fmt.Errorf("file name %q does not match network %q", name, network.Name)
+	}
+	if err := network.Validate(); err != nil {
+		return Network{}, err
+	}
+	network.Source = file
+
+	return network, nil
+}
+
+// Validate checks that the network has a valid name, branch, port and
+// bootstrap multiAddresses, and that it defines the Ethereum URI and the
+// contracts used by the CLI. The name of the Ethereum network defaults to the
+// name of the network. Local networks only need the Ethereum URI, because
+// their contracts and bootstrap Darknodes change with every dev chain, but if
+// they define contracts they must define all of them.
+func (network *Network) Validate() error {
+	if !validNetworkName.MatchString(network.Name) {
+		return fmt.Errorf("invalid network name %q, names contain lowercase letters, digits, '-' and '_'", network.Name)
+	}
+	if network.Branch == "" {
+		return fmt.Errorf("network %q has no branch", network.Name)
+	}
+	if port, err := strconv.Atoi(network.Port); err != nil || port <= 0 || port > 65535 {
+		return fmt.Errorf("network %q has an invalid port %q", network.Name, network.Port)
+	}
+	if network.Ethereum.Network == "" {
+		network.Ethereum.Network = contract.Network(network.Name)
+	}
+	local := network.Ethereum.Network == contract.NetworkLocal
+	if len(network.BootstrapMultiAddresses) == 0 && !local {
+		return fmt.Errorf("network %q has no bootstrap multiAddresses", network.Name)
+	}
+	for _, multiAddress := range network.BootstrapMultiAddresses {
+		if _, err := identity.NewMultiAddressFromString(multiAddress); err != nil {
+			return fmt.Errorf("network %q has an invalid bootstrap multiAddress %q: %v", network.Name, multiAddress, err)
+		}
+	}
+
+	if network.Ethereum.URI == "" {
+		return fmt.Errorf("network %q has no ethereum.uri", network.Name)
+	}
+	required := []struct{ key, value string }{
+		{"republicTokenAddress", network.Ethereum.RepublicTokenAddress},
+		{"darknodeRegistryAddress", network.Ethereum.DarknodeRegistryAddress},
+		{"orderbookAddress", network.Ethereum.OrderbookAddress},
+		{"rewardVaultAddress", network.Ethereum.RewardVaultAddress},
+		{"renExBalancesAddress", network.Ethereum.RenExBalancesAddress},
+		{"renExSettlementAddress", network.Ethereum.RenExSettlementAddress},
+	}
+	missing := 0
+	for _, field := range required {
+		if field.value == "" {
+			missing++
+		}
+	}
+	if local && missing == len(required) {
+		return nil
+	}
+	for _, field := range required {
+		if field.value == "" {
+			return fmt.Errorf("network %q has no ethereum.%s", network.Name, field.key)
+		}
+		if !common.IsHexAddress(field.value) {
+			return fmt.Errorf("network %q has an invalid ethereum.%s %q", network.Name, field.key, field.value)
+		}
+	}
+
+	return nil
+}
+
+// confirmMainnet asks the user to type the name of the network before the
+// action is taken on the mainnet, where bonds and fees are real. Other
+// networks are not confirmed.
+func confirmMainnet(network contract.Network, action string) error {
+	if network != contract.NetworkMainnet {
+		return nil
+	}
+	fmt.Printf("%sYou are about to %s on the mainnet, which uses real REN and ETH.%s\n", RED, action, RESET)
+	fmt.Printf("Type %q to continue: ", contract.NetworkMainnet)
+	text, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if strings.TrimSpace(text) != string(contract.NetworkMainnet) {
+		return ErrMainnetNotConfirmed
+	}
+
+	return nil
+}
+
+// BootstrapNodes parses the bootstrap multiAddresses of the network.
+func (network Network) BootstrapNodes() ([]identity.MultiAddress, error) {
+	multiAddresses := make([]identity.MultiAddress, len(network.BootstrapMultiAddresses))
+	for i, multiAddress := range network.BootstrapMultiAddresses {
+		multi, err := identity.NewMultiAddressFromString(multiAddress)
+		if err != nil {
+			return nil, err
+		}
+		multiAddresses[i] = multi
+	}
+
+	return multiAddresses, nil
+}
+
+// listNetworks prints the known networks.
+func listNetworks(ctx *cli.Context) error {
+	networks, err := LoadNetworks()
+	if err != nil {
+		return err
+	}
+	table := [][]string{{"name", "branch", "port", "bootstrap", "ethereum", "source"}}
+	for _, network := range networks {
+		table = append(table, []string{
+			network.Name,
+			network.Branch,
+			network.Port,
+			strconv.Itoa(len(network.BootstrapMultiAddresses)),
+			network.Ethereum.URI,
+			network.Source,
+		})
+	}
+
+	return printTable(os.Stdout, table)
+}
+
+// showNetwork prints the definition of the network given as argument.
+func showNetwork(ctx *cli.Context) error {
+	name := ctx.Args().First()
+	if name == "" {
+		cli.ShowCommandHelp(ctx, "show")
+		return ErrEmptyNetworkName
+	}
+	network, err := LoadNetwork(name)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(network, "", "    ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+
+	return nil
+}
+
+// addNetwork validates the network defined in the file given as argument and
+// copies it into the networks directory. Existing networks are only replaced
+// with --force.
+func addNetwork(ctx *cli.Context) error {
+	file := ctx.Args().First()
+	if file == "" {
+		cli.ShowCommandHelp(ctx, "add")
+		return ErrEmptyNetworkFile
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	network := Network{}
+	if err := json.Unmarshal(data, &network); err != nil {
+		return err
+	}
+	if err := network.Validate(); err != nil {
+		return fmt.Errorf("%s%v%s", RED, err, RESET)
+	}
+	if _, err := LoadNetwork(network.Name); err == nil && !ctx.Bool("force") {
+		return fmt.Errorf("%snetwork %q already exists, use --force to replace it%s", RED, network.Name, RESET)
+	}
+
+	path, err := saveNetwork(network)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%sNetwork %q has been added to %v.%s\n", GREEN, network.Name, path, RESET)
+
+	return nil
+}
+
+// saveNetwork writes the network into the networks directory and returns the
+// path of its file.
+func saveNetwork(network Network) (string, error) {
+	if err := os.MkdirAll(NetworksDirectory(), 0700); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(network, "", "    ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(NetworksDirectory(), network.Name+".json")
+
+	return path, ioutil.WriteFile(path, data, 0600)
+}
+
+// localNetworkFlags map the flags of `darknode network local` to the fields
+// of the local network they set.
+var localNetworkFlags = []struct {
+	name, usage string
+	field       func(network *Network) *string
+}{
+	{"ethereum-uri", "The `URI` of the Ethereum node of the dev chain, reachable from your computer and the Darknodes", func(network *Network) *string { return &network.Ethereum.URI }},
+	{"republic-token", "The `address` of the RepublicToken contract", func(network *Network) *string { return &network.Ethereum.RepublicTokenAddress }},
+	{"darknode-registry", "The `address` of the DarknodeRegistry contract", func(network *Network) *string { return &network.Ethereum.DarknodeRegistryAddress }},
+	{"orderbook", "The `address` of the Orderbook contract", func(network *Network) *string { return &network.Ethereum.OrderbookAddress }},
+	{"reward-vault", "The `address` of the RewardVault contract", func(network *Network) *string { return &network.Ethereum.RewardVaultAddress }},
+	{"renex-balances", "The `address` of the RenExBalances contract", func(network *Network) *string { return &network.Ethereum.RenExBalancesAddress }},
+	{"renex-settlement", "The `address` of the RenExSettlement contract", func(network *Network) *string { return &network.Ethereum.RenExSettlementAddress }},
+}
+
+// configureLocalNetworkFlags returns the flags of `darknode network local`.
+func configureLocalNetworkFlags() []cli.Flag {
+	flags := []cli.Flag{
+		cli.StringSliceFlag{
+			Name:  "bootstrap",
+			Usage: "The `multiAddress` of a bootstrap Darknode of the dev chain, repeat it for several Darknodes",
+		},
+	}
+	for _, flag := range localNetworkFlags {
+		flags = append(flags, cli.StringFlag{Name: flag.name, Usage: flag.usage})
+	}
+
+	return flags
+}
+
+// configureLocalNetwork sets the Ethereum URI, the contract addresses and the
+// bootstrap Darknodes of the local network from the flags, keeping the values
+// which are not given, and saves it into the networks directory.
+func configureLocalNetwork(ctx *cli.Context) error {
+	network, err := LoadNetwork(string(contract.NetworkLocal))
+	if err != nil {
+		return err
+	}
+	for _, flag := range localNetworkFlags {
+		if ctx.IsSet(flag.name) {
+			*flag.field(&network) = ctx.String(flag.name)
+		}
+	}
+	if ctx.IsSet("bootstrap") {
+		network.BootstrapMultiAddresses = ctx.StringSlice("bootstrap")
+	}
+	if err := network.Validate(); err != nil {
+		return fmt.Errorf("%s%v%s", RED, err, RESET)
+	}
+
+	path, err := saveNetwork(network)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%sThe local network has been saved to %v.%s\n", GREEN, path, RESET)
+
+	return nil
+}
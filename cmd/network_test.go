@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/republicprotocol/republic-go/contract"
+)
+
+// useTempDirectory points Directory to a new temporary directory for the
+// duration of the test. The returned function restores it.
+func useTempDirectory(t *testing.T) func() {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "darknode-cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "darknodes"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	previous := Directory
+	Directory = dir
+
+	return func() {
+		Directory = previous
+		os.RemoveAll(dir)
+	}
+}
+
+// writeNetworkFile writes the network definition into the networks
+// directory under the given file name.
+func writeNetworkFile(t *testing.T, file string, network interface{}) {
+	t.Helper()
+	var data []byte
+	switch network := network.(type) {
+	case string:
+		data = []byte(network)
+	default:
+		var err error
+		if data, err = json.Marshal(network); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(NetworksDirectory(), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(NetworksDirectory(), file), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// withStdin runs f with the standard input reading the given text.
+func withStdin(t *testing.T, text string, f func()) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.WriteString(text); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	previous := os.Stdin
+	os.Stdin = r
+	defer func() {
+		os.Stdin = previous
+		r.Close()
+	}()
+
+	f()
+}
+
+// testMainnet returns a complete definition of a mainnet for tests. Its
+// addresses are not the addresses of the real contracts.
+func testMainnet(t *testing.T) Network {
+	network := bundledNetwork(t, "testnet")
+	network.Name = "mainnet"
+	network.Ethereum.Network = contract.NetworkMainnet
+	network.Ethereum.URI = "https://mainnet.infura.io"
+
+	return network
+}
+
+// bundledNetwork returns the bundled network with the given name.
+func bundledNetwork(t *testing.T, name string) Network {
+	t.Helper()
+	for _, network := range bundledNetworks {
+		if network.Name == name {
+			return network
+		}
+	}
+	t.Fatalf("network %v is not bundled", name)
+
+	return Network{}
+}
+
+func TestLoadNetworkMainnet(t *testing.T) {
+	defer useTempDirectory(t)()
+
+	if _, err := LoadNetwork("mainnet"); err != ErrNoMainnet {
+		t.Fatalf("expected ErrNoMainnet before the mainnet is added, got %v", err)
+	}
+
+	writeNetworkFile(t, "mainnet.json", testMainnet(t))
+	network, err := LoadNetwork("mainnet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if network.Ethereum.Network != contract.NetworkMainnet {
+		t.Errorf("expected the Ethereum network mainnet, got %q", network.Ethereum.Network)
+	}
+	if network.Source != filepath.Join(NetworksDirectory(), "mainnet.json") {
+		t.Errorf("expected the mainnet to be read from its file, got %q", network.Source)
+	}
+}
+
+func TestLoadNetworkUnknown(t *testing.T) {
+	defer useTempDirectory(t)()
+
+	if _, err := LoadNetwork("unknown"); err == nil {
+		t.Fatal("expected an error for an unknown network")
+	}
+	for _, name := range []string{"local", "testnet", "falcon", "nightly"} {
+		network, err := LoadNetwork(name)
+		if err != nil {
+			t.Fatalf("cannot load the bundled network %v: %v", name, err)
+		}
+		if network.Source != "bundled" {
+			t.Errorf("expected %v to be bundled, got %q", name, network.Source)
+		}
+	}
+}
+
+func TestLocalNetworkContracts(t *testing.T) {
+	local := bundledNetwork(t, "local")
+	if err := local.Validate(); err != nil {
+		t.Fatalf("the bundled local network without contracts is invalid: %v", err)
+	}
+
+	local.Ethereum.DarknodeRegistryAddress = "0x5d09eb34ce084bece690651f147dbd8ff41007bf"
+	if err := local.Validate(); err == nil {
+		t.Fatal("expected an error for a local network with only some of the contracts")
+	}
+
+	local.Ethereum = bundledNetwork(t, "testnet").Ethereum
+	local.Ethereum.Network = contract.NetworkLocal
+	if err := local.Validate(); err != nil {
+		t.Fatalf("the local network with all contracts is invalid: %v", err)
+	}
+}
+
+func TestConfirmMainnet(t *testing.T) {
+	tests := []struct {
+		network contract.Network
+		input   string
+		err     error
+	}{
+		{contract.NetworkTestnet, "", nil},
+		{contract.NetworkLocal, "no\n", nil},
+		{contract.NetworkMainnet, "mainnet\n", nil},
+		{contract.NetworkMainnet, "  mainnet  \n", nil},
+		{contract.NetworkMainnet, "yes\n", ErrMainnetNotConfirmed},
+		{contract.NetworkMainnet, "Mainnet\n", ErrMainnetNotConfirmed},
+		{contract.NetworkMainnet, "", ErrMainnetNotConfirmed},
+	}
+	for _, test := range tests {
+		withStdin(t, test.input, func() {
+			if err := confirmMainnet(test.network, "test"); err != test.err {
+				t.Errorf("confirming %v with %q: expected %v, got %v", test.network, test.input, test.err, err)
+			}
+		})
+	}
+}
+
+func TestLoadNetworks(t *testing.T) {
+	defer useTempDirectory(t)()
+
+	staging := bundledNetwork(t, "testnet")
+	staging.Name, staging.Branch = "staging", "staging"
+	staging.Ethereum.Network = ""
+	writeNetworkFile(t, "staging.json", staging)
+
+	override := bundledNetwork(t, "testnet")
+	override.Branch = "release"
+	writeNetworkFile(t, "testnet.json", override)
+
+	writeNetworkFile(t, "broken.json", "{")
+	writeNetworkFile(t, "notes.txt", "not a network")
+
+	networks, err := LoadNetworks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	loaded := map[string]Network{}
+	for _, network := range networks {
+		names = append(names, network.Name)
+		loaded[network.Name] = network
+	}
+	expected := []string{"falcon", "local", "nightly", "staging", "testnet"}
+	if len(names) != len(expected) {
+		t.Fatalf("expected networks %v, got %v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Fatalf("expected networks %v, got %v", expected, names)
+		}
+	}
+
+	tests := []struct {
+		name, branch, source string
+	}{
+		{"falcon", "develop", "bundled"},
+		{"staging", "staging", filepath.Join(NetworksDirectory(), "staging.json")},
+		{"testnet", "release", filepath.Join(NetworksDirectory(), "testnet.json")},
+	}
+	for _, test := range tests {
+		network := loaded[test.name]
+		if network.Branch != test.branch {
+			t.Errorf("expected branch %q of %v, got %q", test.branch, test.name, network.Branch)
+		}
+		if network.Source != test.source {
+			t.Errorf("expected source %q of %v, got %q", test.source, test.name, network.Source)
+		}
+	}
+	if loaded["staging"].Ethereum.Network != "staging" {
+		t.Errorf("expected the Ethereum network to default to the name, got %q", loaded["staging"].Ethereum.Network)
+	}
+}
+
+func TestReadNetworkFile(t *testing.T) {
+	defer useTempDirectory(t)()
+
+	valid := bundledNetwork(t, "testnet")
+	invalid := func(change func(network *Network)) Network {
+		network := bundledNetwork(t, "testnet")
+		change(&network)
+		return network
+	}
+	tests := []struct {
+		description string
+		file        string
+		network     interface{}
+		valid       bool
+	}{
+		{"valid network", "testnet.json", valid, true},
+		{"invalid JSON", "testnet.json", `{"name": "testnet",`, false},
+		{"file name mismatch", "other.json", valid, false},
+		{"invalid name", "Test Net.json", invalid(func(network *Network) { network.Name = "Test Net" }), false},
+		{"no branch", "testnet.json", invalid(func(network *Network) { network.Branch = "" }), false},
+		{"invalid port", "testnet.json", invalid(func(network *Network) { network.Port = "70000" }), false},
+		{"no bootstrap", "testnet.json", invalid(func(network *Network) { network.BootstrapMultiAddresses = nil }), false},
+		{"invalid bootstrap", "testnet.json", invalid(func(network *Network) { network.BootstrapMultiAddresses = []string{"/ip4/1.2.3.4"} }), false},
+		{"no ethereum uri", "testnet.json", invalid(func(network *Network) { network.Ethereum.URI = "" }), false},
+		{"no registry", "testnet.json", invalid(func(network *Network) { network.Ethereum.DarknodeRegistryAddress = "" }), false},
+		{"invalid registry", "testnet.json", invalid(func(network *Network) { network.Ethereum.DarknodeRegistryAddress = "0x1" }), false},
+	}
+	for _, test := range tests {
+		os.RemoveAll(NetworksDirectory())
+		writeNetworkFile(t, test.file, test.network)
+		_, err := readNetworkFile(filepath.Join(NetworksDirectory(), test.file))
+		if test.valid && err != nil {
+			t.Errorf("%v: unexpected error %v", test.description, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%v: expected an error", test.description)
+		}
+	}
+}
+
+func TestInstallBranch(t *testing.T) {
+	data, err := ioutil.ReadFile("../target/darknode/scripts/up.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "git clone -b "+InstallBranch+" ") {
+		t.Fatalf("the up script does not clone the InstallBranch %v", InstallBranch)
+	}
+
+	// Darknodes on these networks keep running the branch they have been
+	// installed from.
+	for _, name := range []string{"local", "testnet"} {
+		if branch := bundledNetwork(t, name).Branch; branch != InstallBranch {
+			t.Errorf("expected %v to run the InstallBranch %v, got %v", name, InstallBranch, branch)
+		}
+	}
+}
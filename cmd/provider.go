@@ -0,0 +1,105 @@
+package main
+
+import (
+	"github.com/urfave/cli"
+)
+
+// Provider is a cloud service provider which can host Darknodes. Each
+// provider is self-contained and is responsible for the instances it creates.
+type Provider interface {
+
+	// Name returns the unique name of the provider.
+	Name() string
+
+	// Flags returns the flags used by the provider when deploying a new
+	// Darknode.
+	Flags() []cli.Flag
+
+	// Selected returns whether the user has chosen the provider in the cli
+	// parameters.
+	Selected(ctx *cli.Context) bool
+
+	// Deploy a new Darknode using the cli parameters.
+	Deploy(ctx *cli.Context) error
+
+	// Destroy tears down the Darknode with the given name and removes its
+	// directory.
+	Destroy(name string) error
+
+	// Start the Darknode with the given name from a suspended state.
+	Start(name string) error
+
+	// Stop the Darknode with the given name by putting it into a suspended
+	// state.
+	Stop(name string) error
+
+	// Resize changes the instance type of the Darknode with the given name.
+	Resize(name, instance string) error
+
+	// Status returns the state of the Darknode service with the given name.
+	Status(name string) (string, error)
+}
+
+// providers contains all registered providers in the order of registration.
+var providers []Provider
+
+// RegisterProvider makes a provider available to all commands. It panics if
+// a provider with the same name has already been registered.
+func RegisterProvider(provider Provider) {
+	if _, err := GetProvider(provider.Name()); err == nil {
+		panic("provider registered twice: " + provider.Name())
+	}
+	providers = append(providers, provider)
+}
+
+// GetProvider returns the registered provider with the given name.
+func GetProvider(name string) (Provider, error) {
+	for _, provider := range providers {
+		if provider.Name() == name {
+			return provider, nil
+		}
+	}
+
+	return nil, ErrUnknownProvider
+}
+
+// providerFlags returns the flags of all registered providers.
+func providerFlags() []cli.Flag {
+	flags := []cli.Flag{}
+	for _, provider := range providers {
+		flags = append(flags, provider.Flags()...)
+	}
+
+	return flags
+}
+
+// selectedProvider returns the provider chosen by the user. Exactly one
+// provider must be selected.
+func selectedProvider(ctx *cli.Context) (Provider, error) {
+	var selected Provider
+	for _, provider := range providers {
+		if !provider.Selected(ctx) {
+			continue
+		}
+		if selected != nil {
+			return nil, ErrMultipleProviders
+		}
+		selected = provider
+	}
+	if selected == nil {
+		return nil, ErrNilProvider
+	}
+
+	return selected, nil
+}
+
+// nodeProvider returns the provider which deployed the Darknode with the
+// given name.
+func nodeProvider(name string) (Provider, error) {
+	node, err := LoadNode(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return GetProvider(node.Provider)
+}
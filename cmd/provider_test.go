@@ -0,0 +1,206 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/urfave/cli"
+)
+
+// fakeProvider is a Provider which records the calls made to it instead of
+// deploying anything.
+type fakeProvider struct {
+	name  string
+	calls *[]string
+}
+
+func (fake fakeProvider) Name() string {
+	return fake.name
+}
+
+func (fake fakeProvider) Flags() []cli.Flag {
+	return []cli.Flag{cli.BoolFlag{Name: fake.name}}
+}
+
+func (fake fakeProvider) Selected(ctx *cli.Context) bool {
+	return ctx.Bool(fake.name)
+}
+
+func (fake fakeProvider) Deploy(ctx *cli.Context) error {
+	fake.record("deploy " + ctx.String("name"))
+	return nil
+}
+
+func (fake fakeProvider) Destroy(name string) error {
+	fake.record("destroy " + name)
+	return os.RemoveAll(NodeDirectory(name))
+}
+
+func (fake fakeProvider) Start(name string) error {
+	fake.record("start " + name)
+	return nil
+}
+
+func (fake fakeProvider) Stop(name string) error {
+	fake.record("stop " + name)
+	return nil
+}
+
+func (fake fakeProvider) Resize(name, instance string) error {
+	fake.record("resize " + name)
+	return nil
+}
+
+func (fake fakeProvider) Status(name string) (string, error) {
+	fake.record("status " + name)
+	return "active", nil
+}
+
+func (fake fakeProvider) record(call string) {
+	*fake.calls = append(*fake.calls, fake.name+": "+call)
+}
+
+// useFakeProviders replaces the registered providers with fake providers
+// with the given names. The returned function restores them.
+func useFakeProviders(calls *[]string, names ...string) func() {
+	previous := providers
+	providers = nil
+	for _, name := range names {
+		RegisterProvider(fakeProvider{name: name, calls: calls})
+	}
+
+	return func() {
+		providers = previous
+	}
+}
+
+// newContext returns a cli context with the flags of all registered
+// providers, the name, network and force flags, parsed from the arguments.
+func newContext(t *testing.T, args ...string) *cli.Context {
+	t.Helper()
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := append(providerFlags(),
+		cli.StringFlag{Name: "name"},
+		cli.StringFlag{Name: "network", Value: "testnet"},
+		cli.StringFlag{Name: "profile"},
+		cli.BoolFlag{Name: "force"},
+	)
+	for _, f := range flags {
+		f.Apply(set)
+	}
+	if err := set.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+
+	return cli.NewContext(cli.NewApp(), set, nil)
+}
+
+// writeFakeNode creates the directory and the node.json of a Darknode
+// deployed by the provider with the given name.
+func writeFakeNode(t *testing.T, name, provider string) {
+	t.Helper()
+	if err := os.MkdirAll(NodeDirectory(name), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveNode(Node{Name: name, Provider: provider, Network: "testnet"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSelectedProvider(t *testing.T) {
+	calls := []string{}
+	defer useFakeProviders(&calls, "first", "second")()
+
+	tests := []struct {
+		args     []string
+		provider string
+		err      error
+	}{
+		{[]string{"--first"}, "first", nil},
+		{[]string{"--second"}, "second", nil},
+		{[]string{"--first", "--second"}, "", ErrMultipleProviders},
+		{[]string{}, "", ErrNilProvider},
+	}
+	for _, test := range tests {
+		provider, err := selectedProvider(newContext(t, test.args...))
+		if err != test.err {
+			t.Errorf("selecting %v: expected %v, got %v", test.args, test.err, err)
+			continue
+		}
+		if err == nil && provider.Name() != test.provider {
+			t.Errorf("selecting %v: expected %v, got %v", test.args, test.provider, provider.Name())
+		}
+	}
+}
+
+func TestRegisterProviderTwice(t *testing.T) {
+	calls := []string{}
+	defer useFakeProviders(&calls, "first")()
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic when a provider is registered twice")
+		}
+	}()
+	RegisterProvider(fakeProvider{name: "first", calls: &calls})
+}
+
+func TestNodeProvider(t *testing.T) {
+	defer useTempDirectory(t)()
+	calls := []string{}
+	defer useFakeProviders(&calls, "first", "second")()
+
+	writeFakeNode(t, "node-1", "second")
+	writeFakeNode(t, "node-2", "unknown")
+
+	provider, err := nodeProvider("node-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provider.Name() != "second" {
+		t.Errorf("expected provider second, got %v", provider.Name())
+	}
+	if _, err := nodeProvider("node-2"); err != ErrUnknownProvider {
+		t.Errorf("expected ErrUnknownProvider, got %v", err)
+	}
+	if _, err := nodeProvider("node-3"); err != ErrNoDeploymentFound {
+		t.Errorf("expected ErrNoDeploymentFound, got %v", err)
+	}
+}
+
+func TestDeployAndDestroyNode(t *testing.T) {
+	defer useTempDirectory(t)()
+	calls := []string{}
+	defer useFakeProviders(&calls, "first", "second")()
+
+	if err := deployNode(newContext(t, "--second", "--name", "node-1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := deployNode(newContext(t, "--first", "--second", "--name", "node-2")); err != ErrMultipleProviders {
+		t.Errorf("expected ErrMultipleProviders, got %v", err)
+	}
+	if err := deployNode(newContext(t, "--name", "node-2")); err != ErrNilProvider {
+		t.Errorf("expected ErrNilProvider, got %v", err)
+	}
+
+	// The Darknode is destroyed by the provider which deployed it, whichever
+	// provider flags are given.
+	writeFakeNode(t, "node-1", "second")
+	if err := destroyNode(newContext(t, "--first", "--name", "node-1", "--force")); err != nil {
+		t.Fatal(err)
+	}
+	if err := destroyNode(newContext(t, "--name", "node-1", "--force")); err != ErrNoDeploymentFound {
+		t.Errorf("expected ErrNoDeploymentFound, got %v", err)
+	}
+
+	expected := []string{"second: deploy node-1", "second: destroy node-1"}
+	if len(calls) != len(expected) {
+		t.Fatalf("expected calls %v, got %v", expected, calls)
+	}
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Fatalf("expected calls %v, got %v", expected, calls)
+		}
+	}
+}
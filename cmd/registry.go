@@ -0,0 +1,414 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/republicprotocol/republic-go/cmd/darknode/config"
+	"github.com/republicprotocol/republic-go/contract"
+	"github.com/republicprotocol/republic-go/contract/bindings"
+	"github.com/republicprotocol/republic-go/crypto"
+	"github.com/republicprotocol/republic-go/identity"
+	"github.com/republicprotocol/republic-go/registry"
+	"github.com/republicprotocol/republic-go/stackint"
+	"github.com/urfave/cli"
+)
+
+// Registry is the part of the Darknode registry used by the CLI. It is
+// implemented by *contract.Binder, and can be implemented on top of a
+// simulated Ethereum backend for testing. Methods sending transactions
+// return once the transaction has been mined.
+type Registry interface {
+
+	// MinimumBond returns the minimum amount of REN needed to register a
+	// Darknode.
+	MinimumBond() (stackint.Int1024, error)
+
+	// ApproveRen allows the Darknode registry to transfer the value of REN
+	// from the owner.
+	ApproveRen(value *stackint.Int1024) (*types.Transaction, error)
+
+	// Register the Darknode with its public key and bond.
+	Register(darknodeID []byte, publicKey []byte, bond *stackint.Int1024) (*types.Transaction, error)
+
+	// IsRegistered returns whether the Darknode is registered in the current
+	// epoch.
+	IsRegistered(darknodeAddr identity.Address) (bool, error)
+
+	// Deregister the Darknode. It stays registered until the next epoch.
+	Deregister(darknodeID []byte) (*types.Transaction, error)
+
+	// IsDeregistered returns whether the Darknode has been deregistered.
+	IsDeregistered(darknodeID []byte) (bool, error)
+
+	// Refund the bond of a deregistered Darknode to its owner.
+	Refund(darknodeID []byte) (*types.Transaction, error)
+
+	// GetBond returns the amount of REN bonded by the Darknode.
+	GetBond(darknodeID []byte) (stackint.Int1024, error)
+
+	// Epoch returns the hash and the block number of the current epoch.
+	Epoch() (registry.Epoch, error)
+
+	// MinimumEpochInterval returns the minimum number of seconds between
+	// epochs.
+	MinimumEpochInterval() (*big.Int, error)
+
+	// GetOwner returns the Ethereum address of the owner of the Darknode.
+	GetOwner(darknodeID []byte) (common.Address, error)
+
+	// Pod returns the pod of the Darknode in the current epoch.
+	Pod(addr identity.Address) (registry.Pod, error)
+
+	// PendingFees returns the fees in ETH earned by the Darknode which have
+	// not been withdrawn from the reward vault.
+	PendingFees(darknodeID []byte) (*big.Int, error)
+}
+
+// binderRegistry implements the Registry using the contract.Binder, and the
+// reward vault for the fees which the binder doesn't expose.
+type binderRegistry struct {
+	*contract.Binder
+	darknodeRegistry *bindings.DarknodeRegistryCaller
+	rewardVault      *bindings.RewardVaultCaller
+}
+
+// Epoch implements the Registry interface. Unlike the binder, it doesn't
+// compute the pods of the epoch, as listing the Darknodes fails while a
+// deregistration is pending.
+func (r binderRegistry) Epoch() (registry.Epoch, error) {
+	epoch, err := r.darknodeRegistry.CurrentEpoch(&bind.CallOpts{})
+	if err != nil {
+		return registry.Epoch{}, err
+	}
+	current := registry.Epoch{BlockNumber: uint(epoch.Blocknumber.Uint64())}
+	copy(current.Hash[:], epoch.Epochhash.Bytes())
+
+	return current, nil
+}
+
+// PendingFees implements the Registry interface.
+func (registry binderRegistry) PendingFees(darknodeID []byte) (*big.Int, error) {
+	eth, err := registry.rewardVault.ETHEREUM(&bind.CallOpts{})
+	if err != nil {
+		return nil, err
+	}
+
+	return registry.rewardVault.DarknodeBalances(&bind.CallOpts{}, common.BytesToAddress(darknodeID), eth)
+}
+
+// connectRegistry connects to the Darknode registry on the Ethereum network.
+// Transactions are signed by auth.
+func connectRegistry(cfg contract.Config, auth *bind.TransactOpts) (Registry, error) {
+	if cfg.Network == contract.NetworkLocal && (cfg.DarknodeRegistryAddress == "" || cfg.RepublicTokenAddress == "" || cfg.RewardVaultAddress == "") {
+		return nil, ErrNoLocalContracts
+	}
+	conn, err := contract.Connect(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return bindRegistry(conn, auth)
+}
+
+// bindRegistry binds the Darknode registry and the reward vault to the
+// Ethereum client of the connection. Transactions are signed by auth.
+func bindRegistry(conn contract.Conn, auth *bind.TransactOpts) (Registry, error) {
+	binder, err := contract.NewBinder(auth, conn)
+	if err != nil {
+		return nil, err
+	}
+	darknodeRegistry, err := bindings.NewDarknodeRegistryCaller(common.HexToAddress(conn.Config.DarknodeRegistryAddress), conn.Client)
+	if err != nil {
+		return nil, err
+	}
+	rewardVault, err := bindings.NewRewardVaultCaller(common.HexToAddress(conn.Config.RewardVaultAddress), conn.Client)
+	if err != nil {
+		return nil, err
+	}
+
+	return binderRegistry{
+		Binder:           &binder,
+		darknodeRegistry: darknodeRegistry,
+		rewardVault:      rewardVault,
+	}, nil
+}
+
+// loadOwnerKey decrypts the Ethereum keystore file of the owner of the
+// Darknodes. The user is asked for the passphrase if none is given.
+func loadOwnerKey(keystoreFile, passphrase string) (*keystore.Key, error) {
+	if keystoreFile == "" {
+		return nil, ErrEmptyOwnerKeystore
+	}
+	data, err := ioutil.ReadFile(keystoreFile)
+	if err != nil {
+		return nil, err
+	}
+	if passphrase == "" {
+		passphrase, err = readPassphrase("Passphrase of the owner keystore: ")
+		if err != nil {
+			return nil, err
+		}
+	}
+	key, err := keystore.DecryptKey(data, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("%scannot decrypt the owner keystore: %v%s", RED, err, RESET)
+	}
+
+	return key, nil
+}
+
+// ownerRegistry connects to the Darknode registry of the network of the
+// Darknode, signing transactions with the key of the owner given in the cli
+// parameters.
+func ownerRegistry(ctx *cli.Context, cfg config.Config) (Registry, error) {
+	passphrase, err := flagPassphrase(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key, err := loadOwnerKey(ctx.String("keystore"), passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	return connectRegistry(cfg.Ethereum, bind.NewKeyedTransactor(key.PrivateKey))
+}
+
+// registerNode registers the Darknode with the given name in the Darknode
+// registry, bonding the minimum amount of REN from the owner.
+func registerNode(ctx *cli.Context) error {
+	name := ctx.String("name")
+	if name == "" {
+		cli.ShowCommandHelp(ctx, "register")
+		return ErrEmptyNodeName
+	}
+	cfg, err := loadConfig(name)
+	if err != nil {
+		return err
+	}
+	if err := confirmMainnet(cfg.Ethereum.Network, fmt.Sprintf("register [%s]", name)); err != nil {
+		return err
+	}
+	registry, err := ownerRegistry(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	return registerDarknode(registry, name, cfg)
+}
+
+// registerDarknode approves the minimum bond and registers the Darknode with
+// the RSA public key from its config.
+func registerDarknode(registry Registry, name string, cfg config.Config) error {
+	registered, err := registry.IsRegistered(cfg.Address)
+	if err != nil {
+		return err
+	}
+	if registered {
+		fmt.Printf("%s[%s] is already registered.%s\n", GREEN, name, RESET)
+		return nil
+	}
+
+	bond, err := registry.MinimumBond()
+	if err != nil {
+		return err
+	}
+	publicKey, err := crypto.BytesFromRsaPublicKey(&cfg.Keystore.RsaKey.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Approving %v REN for the bond of [%s] ...\n", formatAmount(bond.ToBigInt()), name)
+	if _, err := registry.ApproveRen(&bond); err != nil {
+		return err
+	}
+	fmt.Printf("Registering [%s] ...\n", name)
+	tx, err := registry.Register(cfg.Address.ID(), publicKey, &bond)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s[%s] will be registered in the next epoch (transaction %s).%s\n", GREEN, name, tx.Hash().Hex(), RESET)
+
+	return nil
+}
+
+// deregisterNode deregisters the Darknode with the given name from the
+// Darknode registry, and records a pending refund of its bond. The refund is
+// made as soon as possible if the user wants to wait for it.
+func deregisterNode(ctx *cli.Context) error {
+	name := ctx.String("name")
+	if name == "" {
+		cli.ShowCommandHelp(ctx, "deregister")
+		return ErrEmptyNodeName
+	}
+	cfg, err := loadConfig(name)
+	if err != nil {
+		return err
+	}
+	if err := confirmMainnet(cfg.Ethereum.Network, fmt.Sprintf("deregister [%s]", name)); err != nil {
+		return err
+	}
+	registry, err := ownerRegistry(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	deregistered, err := deregisterDarknode(registry, name, cfg)
+	if err != nil || !deregistered {
+		return err
+	}
+	pending, err := recordPendingRefund(registry, name, cfg)
+	if err != nil || !pending {
+		return err
+	}
+	if !ctx.Bool("wait-refund") {
+		fmt.Printf("%sRun `darknode refund --pending` to refund the bond once it becomes refundable.%s\n", GREEN, RESET)
+		return nil
+	}
+
+	return waitForRefund(registry, name, cfg, ctx.Duration("poll"))
+}
+
+// deregisterDarknode deregisters the Darknode if it is registered. It returns
+// whether the Darknode is being deregistered or has been deregistered.
+func deregisterDarknode(registry Registry, name string, cfg config.Config) (bool, error) {
+	registered, err := registry.IsRegistered(cfg.Address)
+	if err != nil {
+		return false, err
+	}
+	if !registered {
+		deregistered, err := registry.IsDeregistered(cfg.Address.ID())
+		if err != nil {
+			return false, err
+		}
+		if deregistered {
+			fmt.Printf("%s[%s] has already been deregistered.%s\n", GREEN, name, RESET)
+		} else {
+			fmt.Printf("%s[%s] is not registered.%s\n", GREEN, name, RESET)
+		}
+		return deregistered, nil
+	}
+
+	fmt.Printf("Deregistering [%s] ...\n", name)
+	tx, err := registry.Deregister(cfg.Address.ID())
+	if err != nil {
+		return false, err
+	}
+	fmt.Printf("%s[%s] will be deregistered in the next epoch (transaction %s).%s\n", GREEN, name, tx.Hash().Hex(), RESET)
+
+	return true, nil
+}
+
+// refundNode refunds the bond of the deregistered Darknode with the given
+// name to its owner, or the bonds of all Darknodes with a pending refund.
+func refundNode(ctx *cli.Context) error {
+	name := ctx.String("name")
+	if ctx.Bool("pending") {
+		return refundPending(ctx)
+	}
+	if name == "" {
+		cli.ShowCommandHelp(ctx, "refund")
+		return ErrEmptyNodeName
+	}
+	cfg, err := loadConfig(name)
+	if err != nil {
+		return err
+	}
+	registry, err := ownerRegistry(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	return refundDarknode(registry, name, cfg)
+}
+
+// refundDarknode refunds the bond of the Darknode if it has been
+// deregistered and still holds a bond.
+func refundDarknode(registry Registry, name string, cfg config.Config) error {
+	bond, err := registry.GetBond(cfg.Address.ID())
+	if err != nil {
+		return err
+	}
+	if bond.IsZero() {
+		fmt.Printf("%s[%s] has no bond to refund.%s\n", GREEN, name, RESET)
+		return clearPendingRefund(name)
+	}
+	registered, err := registry.IsRegistered(cfg.Address)
+	if err != nil {
+		return err
+	}
+	if registered {
+		return fmt.Errorf("%s[%s] is still registered, run `darknode deregister --name %s` first%s", RED, name, name, RESET)
+	}
+	deregistered, err := registry.IsDeregistered(cfg.Address.ID())
+	if err != nil {
+		return err
+	}
+	if !deregistered {
+		return fmt.Errorf("%s[%s] has not been deregistered yet, the bond can be refunded after the deregistration has completed%s", RED, name, RESET)
+	}
+
+	fmt.Printf("Refunding %v REN bonded by [%s] ...\n", formatAmount(bond.ToBigInt()), name)
+	tx, err := registry.Refund(cfg.Address.ID())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%sThe bond of [%s] has been refunded (transaction %s).%s\n", GREEN, name, tx.Hash().Hex(), RESET)
+
+	return clearPendingRefund(name)
+}
+
+// checkRefunded returns an error unless the Darknode with the given name is
+// not registered and holds no bond, so it can be destroyed safely.
+func checkRefunded(name string) error {
+	cfg, err := loadConfig(name)
+	if err != nil {
+		return err
+	}
+	registry, err := connectRegistry(cfg.Ethereum, &bind.TransactOpts{})
+	if err != nil {
+		return fmt.Errorf("%scannot check the registration of [%s]: %v, use --force to destroy it anyway%s", RED, name, err, RESET)
+	}
+
+	return checkDarknodeRefunded(registry, name, cfg)
+}
+
+// checkDarknodeRefunded returns an error if the Darknode is still registered
+// or still holds a bond in the registry.
+func checkDarknodeRefunded(registry Registry, name string, cfg config.Config) error {
+	registered, err := registry.IsRegistered(cfg.Address)
+	if err != nil {
+		return fmt.Errorf("%scannot check the registration of [%s]: %v, use --force to destroy it anyway%s", RED, name, err, RESET)
+	}
+	if registered {
+		return fmt.Errorf("%s[%s] is still registered, run `darknode deregister --name %s` and `darknode refund --name %s` before destroying it%s", RED, name, name, name, RESET)
+	}
+	bond, err := registry.GetBond(cfg.Address.ID())
+	if err != nil {
+		return fmt.Errorf("%scannot check the bond of [%s]: %v, use --force to destroy it anyway%s", RED, name, err, RESET)
+	}
+	if !bond.IsZero() {
+		return fmt.Errorf("%s[%s] still holds a bond of %v REN, run `darknode refund --name %s` before destroying it%s", RED, name, formatAmount(bond.ToBigInt()), name, RESET)
+	}
+
+	return nil
+}
+
+// formatAmount formats an amount of the smallest unit of a token with 18
+// decimals, like REN and ETH.
+func formatAmount(value *big.Int) string {
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+	whole, fraction := new(big.Int).QuoRem(value, unit, new(big.Int))
+	if fraction.Sign() == 0 {
+		return whole.String()
+	}
+	decimals := strings.TrimRight(fmt.Sprintf("%018s", new(big.Int).Abs(fraction).String()), "0")
+
+	return whole.String() + "." + decimals
+}
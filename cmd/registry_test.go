@@ -0,0 +1,297 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/republicprotocol/republic-go/cmd/darknode/config"
+	"github.com/republicprotocol/republic-go/crypto"
+	"github.com/republicprotocol/republic-go/identity"
+	"github.com/republicprotocol/republic-go/registry"
+	"github.com/republicprotocol/republic-go/stackint"
+)
+
+// fakeRegistry is a Registry holding the state of a single Darknode. It
+// records the transactions sent to it.
+type fakeRegistry struct {
+	registered   bool
+	deregistered bool
+	bond         uint
+	epoch        uint
+	refundErr    error
+	err          error
+
+	calls []string
+}
+
+func (fake *fakeRegistry) MinimumBond() (stackint.Int1024, error) {
+	return stackint.FromUint(100000), fake.err
+}
+
+func (fake *fakeRegistry) ApproveRen(value *stackint.Int1024) (*types.Transaction, error) {
+	return fake.transaction("approve " + value.String())
+}
+
+func (fake *fakeRegistry) Register(darknodeID []byte, publicKey []byte, bond *stackint.Int1024) (*types.Transaction, error) {
+	return fake.transaction("register " + bond.String())
+}
+
+func (fake *fakeRegistry) IsRegistered(darknodeAddr identity.Address) (bool, error) {
+	fake.calls = append(fake.calls, "is registered")
+	return fake.registered, fake.err
+}
+
+func (fake *fakeRegistry) Deregister(darknodeID []byte) (*types.Transaction, error) {
+	return fake.transaction("deregister")
+}
+
+func (fake *fakeRegistry) IsDeregistered(darknodeID []byte) (bool, error) {
+	fake.calls = append(fake.calls, "is deregistered")
+	return fake.deregistered, fake.err
+}
+
+func (fake *fakeRegistry) Refund(darknodeID []byte) (*types.Transaction, error) {
+	if fake.refundErr != nil {
+		return nil, fake.refundErr
+	}
+	fake.bond = 0
+	return fake.transaction("refund")
+}
+
+func (fake *fakeRegistry) GetBond(darknodeID []byte) (stackint.Int1024, error) {
+	return stackint.FromUint(fake.bond), fake.err
+}
+
+func (fake *fakeRegistry) Epoch() (registry.Epoch, error) {
+	return registry.Epoch{BlockNumber: fake.epoch}, fake.err
+}
+
+func (fake *fakeRegistry) MinimumEpochInterval() (*big.Int, error) {
+	return big.NewInt(3600), fake.err
+}
+
+func (fake *fakeRegistry) GetOwner(darknodeID []byte) (common.Address, error) {
+	return common.Address{}, fake.err
+}
+
+func (fake *fakeRegistry) Pod(addr identity.Address) (registry.Pod, error) {
+	return registry.Pod{}, fake.err
+}
+
+func (fake *fakeRegistry) PendingFees(darknodeID []byte) (*big.Int, error) {
+	return big.NewInt(0), fake.err
+}
+
+func (fake *fakeRegistry) transaction(call string) (*types.Transaction, error) {
+	fake.calls = append(fake.calls, call)
+	return types.NewTransaction(0, common.Address{}, big.NewInt(0), 0, big.NewInt(0), nil), fake.err
+}
+
+// sent returns the transactions sent to the registry.
+func (fake *fakeRegistry) sent() []string {
+	sent := []string{}
+	for _, call := range fake.calls {
+		if call != "is registered" && call != "is deregistered" {
+			sent = append(sent, call)
+		}
+	}
+
+	return sent
+}
+
+// testConfig returns the config of a Darknode with a random keystore.
+func testConfig(t *testing.T) config.Config {
+	t.Helper()
+	keystore, err := crypto.RandomKeystore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return config.Config{
+		Keystore: keystore,
+		Address:  identity.Address(keystore.Address()),
+	}
+}
+
+// writePendingRefund creates a Darknode with a pending refund started in
+// the given epoch.
+func writePendingRefund(t *testing.T, name string, epoch uint) {
+	t.Helper()
+	writeFakeNode(t, name, "server")
+	node, err := LoadNode(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node.Pending = &PendingAction{Action: ActionRefund, Epoch: epoch}
+	if err := SaveNode(node); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func equalCalls(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestRegisterDarknode(t *testing.T) {
+	cfg := testConfig(t)
+	tests := []struct {
+		registered bool
+		sent       []string
+	}{
+		{true, []string{}},
+		{false, []string{"approve 100000", "register 100000"}},
+	}
+	for _, test := range tests {
+		fake := &fakeRegistry{registered: test.registered}
+		if err := registerDarknode(fake, "node", cfg); err != nil {
+			t.Fatal(err)
+		}
+		if !equalCalls(fake.sent(), test.sent) {
+			t.Errorf("registered %v: expected transactions %v, got %v", test.registered, test.sent, fake.sent())
+		}
+	}
+}
+
+func TestDeregisterDarknode(t *testing.T) {
+	cfg := testConfig(t)
+	tests := []struct {
+		registered, deregistered bool
+		result                   bool
+		sent                     []string
+	}{
+		{true, false, true, []string{"deregister"}},
+		{false, true, true, []string{}},
+		{false, false, false, []string{}},
+	}
+	for _, test := range tests {
+		fake := &fakeRegistry{registered: test.registered, deregistered: test.deregistered}
+		result, err := deregisterDarknode(fake, "node", cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != test.result {
+			t.Errorf("registered %v, deregistered %v: expected %v, got %v", test.registered, test.deregistered, test.result, result)
+		}
+		if !equalCalls(fake.sent(), test.sent) {
+			t.Errorf("registered %v, deregistered %v: expected transactions %v, got %v", test.registered, test.deregistered, test.sent, fake.sent())
+		}
+	}
+}
+
+func TestRefundDarknode(t *testing.T) {
+	defer useTempDirectory(t)()
+	cfg := testConfig(t)
+	tests := []struct {
+		registered, deregistered bool
+		bond                     uint
+		valid                    bool
+		sent                     []string
+	}{
+		{false, true, 0, true, []string{}},
+		{true, false, 100000, false, []string{}},
+		{false, false, 100000, false, []string{}},
+		{false, true, 100000, true, []string{"refund"}},
+	}
+	for _, test := range tests {
+		writePendingRefund(t, "node", 1)
+		fake := &fakeRegistry{registered: test.registered, deregistered: test.deregistered, bond: test.bond}
+		err := refundDarknode(fake, "node", cfg)
+		if test.valid != (err == nil) {
+			t.Errorf("registered %v, deregistered %v, bond %v: unexpected error %v", test.registered, test.deregistered, test.bond, err)
+		}
+		if !equalCalls(fake.sent(), test.sent) {
+			t.Errorf("registered %v, deregistered %v, bond %v: expected transactions %v, got %v", test.registered, test.deregistered, test.bond, test.sent, fake.sent())
+		}
+		node, err := LoadNode("node")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.valid != (node.Pending == nil) {
+			t.Errorf("registered %v, deregistered %v, bond %v: unexpected pending action %+v", test.registered, test.deregistered, test.bond, node.Pending)
+		}
+	}
+}
+
+func TestTryPendingRefund(t *testing.T) {
+	defer useTempDirectory(t)()
+	cfg := testConfig(t)
+	writePendingRefund(t, "node", 10)
+	fake := &fakeRegistry{bond: 100000, epoch: 10}
+
+	tests := []struct {
+		description  string
+		epoch        uint
+		deregistered bool
+		refundErr    error
+		done         bool
+		attempted    uint
+		calls        []string
+	}{
+		{"deregistration has not completed", 10, false, nil, false, 10, []string{"is deregistered"}},
+		{"epoch already attempted", 10, true, nil, false, 10, []string{}},
+		{"refund fails", 11, true, errors.New("not refundable"), false, 11, []string{"is deregistered", "is registered", "is deregistered"}},
+		{"epoch already attempted after the refund failed", 11, true, nil, false, 11, []string{}},
+		{"refund succeeds", 12, true, nil, true, 0, []string{"is deregistered", "is registered", "is deregistered", "refund"}},
+		{"nothing pending", 13, true, nil, true, 0, []string{}},
+	}
+	for _, test := range tests {
+		fake.calls = nil
+		fake.epoch, fake.deregistered, fake.refundErr = test.epoch, test.deregistered, test.refundErr
+		done, err := tryPendingRefund(fake, "node", cfg)
+		if err != nil {
+			t.Fatalf("%v: %v", test.description, err)
+		}
+		if done != test.done {
+			t.Errorf("%v: expected done %v, got %v", test.description, test.done, done)
+		}
+		if !equalCalls(fake.calls, test.calls) {
+			t.Errorf("%v: expected calls %v, got %v", test.description, test.calls, fake.calls)
+		}
+		node, err := LoadNode("node")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.done {
+			if node.Pending != nil {
+				t.Errorf("%v: expected the pending refund to be cleared, got %+v", test.description, node.Pending)
+			}
+			continue
+		}
+		if node.Pending == nil || node.Pending.AttemptedEpoch != test.attempted {
+			t.Errorf("%v: expected the attempted epoch %v, got %+v", test.description, test.attempted, node.Pending)
+		}
+	}
+}
+
+func TestCheckDarknodeRefunded(t *testing.T) {
+	cfg := testConfig(t)
+	tests := []struct {
+		description string
+		fake        *fakeRegistry
+		valid       bool
+	}{
+		{"refunded", &fakeRegistry{deregistered: true}, true},
+		{"never registered", &fakeRegistry{}, true},
+		{"still registered", &fakeRegistry{registered: true, bond: 100000}, false},
+		{"bond not refunded", &fakeRegistry{deregistered: true, bond: 100000}, false},
+		{"registry unavailable", &fakeRegistry{err: errors.New("connection refused")}, false},
+	}
+	for _, test := range tests {
+		err := checkDarknodeRefunded(test.fake, "node", cfg)
+		if test.valid != (err == nil) {
+			t.Errorf("%v: unexpected error %v", test.description, err)
+		}
+	}
+}
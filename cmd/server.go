@@ -0,0 +1,298 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+func init() {
+	RegisterProvider(ServerProvider{})
+}
+
+// ServerProvider deploys Darknodes to existing servers owned by the user. It
+// provisions the server over ssh and never creates nor deletes machines.
+//
+// To keep the server compatible with the other commands, the provider makes
+// sure an `ubuntu` user with passwordless sudo exists and authorizes the ssh
+// key pair generated for the Darknode.
+type ServerProvider struct{}
+
+// Name implements the Provider interface.
+func (server ServerProvider) Name() string {
+	return "server"
+}
+
+// Flags implements the Provider interface.
+func (server ServerProvider) Flags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:  "ssh-host",
+			Usage: "IP `address` of an existing server which will be provisioned over ssh",
+		},
+		cli.StringFlag{
+			Name:  "ssh-user",
+			Value: "ubuntu",
+			Usage: "An optional `user` with sudo access on the server",
+		},
+		cli.StringFlag{
+			Name:  "ssh-key",
+			Value: "~/.ssh/id_rsa",
+			Usage: "An optional private key `file` used to access the server",
+		},
+	}
+}
+
+// Selected implements the Provider interface.
+func (server ServerProvider) Selected(ctx *cli.Context) bool {
+	return ctx.String("ssh-host") != ""
+}
+
+// Deploy provisions the server with the Darknode software and configuration,
+// the same way terraform provisions a new instance.
+func (server ServerProvider) Deploy(ctx *cli.Context) error {
+	user := ctx.String("ssh-user")
+	key := ctx.String("ssh-key")
+	if strings.HasPrefix(key, "~/") {
+		key = path.Join(os.Getenv("HOME"), key[2:])
+	}
+	ip, err := resolveIPv4(ctx.String("ssh-host"))
+	if err != nil {
+		return err
+	}
+
+	nodeDirectory, config, pubKey, err := initNode(ctx, server, "", "")
+	if err != nil {
+		return err
+	}
+	if err := provisionServer(nodeDirectory, ip, user, key, pubKey); err != nil {
+		if err := cleanUp(nodeDirectory); err != nil {
+			return err
+		}
+		return err
+	}
+	node, err := LoadNode(ctx.String("name"))
+	if err == nil {
+		err = node.SetMultiAddress(fmt.Sprintf("/ip4/%v/tcp/%v/republic/%v", ip, config.Port, config.Address))
+	}
+	if err == nil {
+		err = SaveNode(node)
+	}
+	if err != nil {
+		if err := cleanUp(nodeDirectory); err != nil {
+			return err
+		}
+		return err
+	}
+
+	return finishDeployment(ctx)
+}
+
+// serverDestroyScript stops and removes the services started by the up
+// script and everything it installed, so the server can be provisioned again.
+const serverDestroyScript = `
+sudo systemctl stop darknode.service darknode-updater.service logstash.service metricbeat.service
+sudo systemctl disable darknode.service darknode-updater.service logstash.service metricbeat.service
+sudo rm -f /etc/systemd/system/darknode.service /etc/systemd/system/darknode-updater.service /etc/systemd/system/logstash.service
+sudo dpkg --purge metricbeat
+sudo rm -rf /etc/metricbeat
+sudo systemctl daemon-reload
+rm -rf $HOME/.darknode $HOME/logstash-6.2.2 $HOME/go/src/github.com/republicprotocol/republic-go $HOME/go/bin/darknode $HOME/go/bin/dep $HOME/go/pkg/dep
+sudo rm -rf /usr/local/go /usr/bin/go
+sed -i '\#^export PATH=.*:/usr/local/go/bin$#d' $HOME/.profile
+`
+
+// Destroy stops and removes the Darknode services, the software installed by
+// the up script, the configuration and the ssh key of the Darknode from the
+// server. The sudoers file and the ubuntu user are removed if they were
+// created when the server was provisioned. The server itself is left running.
+func (server ServerProvider) Destroy(name string) error {
+	fmt.Printf("%sRemoving your darknode from the server ...%s\n", GREEN, RESET)
+	node, err := LoadNode(name)
+	if err != nil {
+		return err
+	}
+	nodeDirectory := NodeDirectory(name)
+	pubKey, err := ioutil.ReadFile(nodeDirectory + "/ssh_keypair.pub")
+	if err != nil {
+		return err
+	}
+	destroyScript := serverDestroyScript
+	if !node.ServerUser {
+		// Keep authorized_keys intact if the key of the Darknode is the only
+		// authorized key, so the file is never left empty.
+		destroyScript += fmt.Sprintf(`
+KEY=%s
+if grep -v -F -x "$KEY" $HOME/.ssh/authorized_keys | grep -q .; then
+  grep -v -F -x "$KEY" $HOME/.ssh/authorized_keys > $HOME/.ssh/authorized_keys.tmp
+  cat $HOME/.ssh/authorized_keys.tmp > $HOME/.ssh/authorized_keys
+  rm -f $HOME/.ssh/authorized_keys.tmp
+else
+  echo "The ssh key of the Darknode is the only authorized key of the ubuntu user and has been kept."
+fi
+`, shellQuote(strings.TrimSpace(string(pubKey))))
+	}
+	if node.ServerSudoers {
+		destroyScript += "sudo rm -f /etc/sudoers.d/darknode-ubuntu\n"
+	}
+	if err := runRemoteScript(name, destroyScript); err != nil {
+		return err
+	}
+	if node.ServerUser {
+		if err := removeServerUser(node); err != nil {
+			return err
+		}
+	}
+
+	return cleanUp(nodeDirectory)
+}
+
+// Start implements the Provider interface.
+func (server ServerProvider) Start(name string) error {
+	return runRemoteScript(name, "sudo systemctl start darknode")
+}
+
+// Stop implements the Provider interface.
+func (server ServerProvider) Stop(name string) error {
+	return runRemoteScript(name, "sudo systemctl stop darknode")
+}
+
+// Resize is not supported as the server is not managed by the Darknode CLI.
+func (server ServerProvider) Resize(name, instance string) error {
+	return ErrResizeUnsupported
+}
+
+// Status implements the Provider interface.
+func (server ServerProvider) Status(name string) (string, error) {
+	return serviceStatus(name)
+}
+
+// provisionServer authorizes the ssh key of the Darknode for the ubuntu user,
+// uploads the config and provisions, and runs the up script on the server.
+// Whether the ubuntu user and its sudoers file had to be created is recorded
+// in the node.json, and they are removed again if provisioning fails.
+func provisionServer(nodeDirectory, ip, user, key, pubKey string) error {
+	fmt.Printf("%sProvisioning the server at %v%s...\n", GREEN, ip, RESET)
+
+	authorizeScript := fmt.Sprintf(`
+set -e
+if ! id -u ubuntu > /dev/null 2>&1; then
+  sudo adduser --disabled-password --gecos '' ubuntu > /dev/null
+  echo created-user
+fi
+if ! sudo test -e /etc/sudoers.d/darknode-ubuntu; then
+  echo 'ubuntu ALL=(ALL) NOPASSWD:ALL' | sudo tee /etc/sudoers.d/darknode-ubuntu > /dev/null
+  echo created-sudoers
+fi
+sudo mkdir -p /home/ubuntu/.ssh
+echo '%s' | sudo tee -a /home/ubuntu/.ssh/authorized_keys > /dev/null
+sudo chown -R ubuntu:ubuntu /home/ubuntu/.ssh
+sudo chmod 700 /home/ubuntu/.ssh
+sudo chmod 600 /home/ubuntu/.ssh/authorized_keys
+`, strings.TrimSpace(pubKey))
+	auth, err := keyFileAuth(key)
+	if err != nil {
+		return err
+	}
+	name := filepath.Base(nodeDirectory)
+	client, err := DialSSH(name, ip, user, auth, recordHostKey(nodeDirectory))
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	output, err := client.Output(authorizeScript)
+	node, loadErr := LoadNode(name)
+	if loadErr != nil {
+		return loadErr
+	}
+	node.ServerLogin, node.ServerKey = user, key
+	node.ServerUser = strings.Contains(output, "created-user")
+	node.ServerSudoers = strings.Contains(output, "created-sudoers")
+	if err == nil {
+		err = SaveNode(node)
+	}
+	if err == nil {
+		err = uploadAndRunUpScript(name, nodeDirectory)
+	}
+	if err != nil {
+		revertScript := ""
+		if node.ServerSudoers {
+			revertScript += "sudo rm -f /etc/sudoers.d/darknode-ubuntu\n"
+		}
+		if node.ServerUser {
+			revertScript += "sudo pkill -u ubuntu; sudo userdel -r ubuntu\n"
+		}
+		if revertScript != "" {
+			client.Run(revertScript)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// uploadAndRunUpScript uploads the config and the provisions to the server
+// and runs the up script as the ubuntu user.
+func uploadAndRunUpScript(name, nodeDirectory string) error {
+	node, err := DialNode(name)
+	if err != nil {
+		return err
+	}
+	defer node.Close()
+	if err := node.Upload(nodeDirectory+"/config.json", "/home/ubuntu/darknode-config.json"); err != nil {
+		return err
+	}
+	if err := node.Upload(Directory+"/provisions", "/home/ubuntu/provisions"); err != nil {
+		return err
+	}
+	upScript, err := os.Open(Directory + "/scripts/up.sh")
+	if err != nil {
+		return err
+	}
+	defer upScript.Close()
+
+	return node.RunWithInput("cd /home/ubuntu && sh -s", upScript)
+}
+
+// removeServerUser removes the ubuntu user created when the server was
+// provisioned. It connects as the user which provisioned the server, as the
+// ubuntu user cannot remove itself.
+func removeServerUser(node Node) error {
+	hostKeyCallback, err := trustedHostKey(node.Name)
+	if err != nil {
+		return err
+	}
+	auth, err := keyFileAuth(node.ServerKey)
+	if err != nil {
+		return fmt.Errorf("%scannot remove the ubuntu user from [%s], the key %v of %v cannot be read: %v%s", RED, node.Name, node.ServerKey, node.ServerLogin, err, RESET)
+	}
+	client, err := DialSSH(node.Name, node.IP, node.ServerLogin, auth, hostKeyCallback)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.Run("sudo pkill -u ubuntu; sudo userdel -r ubuntu")
+}
+
+// resolveIPv4 returns the IPv4 address of the host, which can either be an
+// IP address or a hostname.
+func resolveIPv4(host string) (string, error) {
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return "", err
+	}
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			return ip.String(), nil
+		}
+	}
+
+	return "", ErrNoIPv4Address
+}
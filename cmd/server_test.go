@@ -0,0 +1,36 @@
+package main
+
+import (
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestServerDestroyScript(t *testing.T) {
+	data, err := ioutil.ReadFile("../target/darknode/scripts/up.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := regexp.MustCompile(`(?m)^sudo systemctl start (\S+)`).FindAllStringSubmatch(string(data), -1)
+	if len(started) == 0 {
+		t.Fatal("the up script does not start any service")
+	}
+
+	// Every service started by the up script is stopped and disabled, so
+	// nothing keeps running once the Darknode is destroyed.
+	lines := strings.Split(serverDestroyScript, "\n")
+	for _, service := range started {
+		for _, command := range []string{"sudo systemctl stop ", "sudo systemctl disable "} {
+			found := false
+			for _, line := range lines {
+				if strings.HasPrefix(line, command) && strings.Contains(line+" ", " "+service[1]+" ") {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("expected the destroy script to run %v%v", command, service[1])
+			}
+		}
+	}
+}
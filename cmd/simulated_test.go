@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/republicprotocol/republic-go/contract"
+	"github.com/republicprotocol/republic-go/contract/bindings"
+	"github.com/republicprotocol/republic-go/crypto"
+	"github.com/republicprotocol/republic-go/stackint"
+)
+
+// SimulatedEthereum serves the part of the eth JSON-RPC API used by the
+// contract bindings from a simulated backend. Transactions stay pending
+// until their receipt is requested, so a transaction is only mined if the
+// CLI waits for it.
+type SimulatedEthereum struct {
+	backend *backends.SimulatedBackend
+}
+
+// CallArgs are the arguments of eth_call and eth_estimateGas. The types of
+// the rpc service and its arguments must be exported.
+type CallArgs struct {
+	From     common.Address  `json:"from"`
+	To       *common.Address `json:"to"`
+	Gas      hexutil.Uint64  `json:"gas"`
+	GasPrice *hexutil.Big    `json:"gasPrice"`
+	Value    *hexutil.Big    `json:"value"`
+	Data     hexutil.Bytes   `json:"data"`
+}
+
+func (args CallArgs) msg() ethereum.CallMsg {
+	return ethereum.CallMsg{
+		From:     args.From,
+		To:       args.To,
+		Gas:      uint64(args.Gas),
+		GasPrice: (*big.Int)(args.GasPrice),
+		Value:    (*big.Int)(args.Value),
+		Data:     args.Data,
+	}
+}
+
+func (eth *SimulatedEthereum) GetCode(ctx context.Context, address common.Address, block string) (hexutil.Bytes, error) {
+	if block == "pending" {
+		return eth.backend.PendingCodeAt(ctx, address)
+	}
+	return eth.backend.CodeAt(ctx, address, nil)
+}
+
+func (eth *SimulatedEthereum) GetTransactionCount(ctx context.Context, address common.Address, block string) (hexutil.Uint64, error) {
+	nonce, err := eth.backend.PendingNonceAt(ctx, address)
+	return hexutil.Uint64(nonce), err
+}
+
+func (eth *SimulatedEthereum) Call(ctx context.Context, args CallArgs, block string) (hexutil.Bytes, error) {
+	return eth.backend.CallContract(ctx, args.msg(), nil)
+}
+
+func (eth *SimulatedEthereum) EstimateGas(ctx context.Context, args CallArgs) (hexutil.Uint64, error) {
+	gas, err := eth.backend.EstimateGas(ctx, args.msg())
+	return hexutil.Uint64(gas), err
+}
+
+func (eth *SimulatedEthereum) GasPrice(ctx context.Context) (*hexutil.Big, error) {
+	price, err := eth.backend.SuggestGasPrice(ctx)
+	return (*hexutil.Big)(price), err
+}
+
+func (eth *SimulatedEthereum) SendRawTransaction(ctx context.Context, data hexutil.Bytes) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(data, tx); err != nil {
+		return common.Hash{}, err
+	}
+	return tx.Hash(), eth.backend.SendTransaction(ctx, tx)
+}
+
+// GetTransactionReceipt mines the pending transactions the first time the
+// receipt of a pending transaction is requested.
+func (eth *SimulatedEthereum) GetTransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	receipt, err := eth.backend.TransactionReceipt(ctx, hash)
+	if receipt == nil {
+		eth.backend.Commit()
+	}
+	return receipt, err
+}
+
+// minedRegistry checks that the transactions sent by the CLI have been mined
+// successfully when the Registry returns, and records their order.
+type minedRegistry struct {
+	Registry
+	t       *testing.T
+	backend *backends.SimulatedBackend
+	calls   []string
+}
+
+func (registry *minedRegistry) mined(call string, tx *types.Transaction, err error) (*types.Transaction, error) {
+	registry.t.Helper()
+	if err != nil {
+		return tx, err
+	}
+	registry.calls = append(registry.calls, call)
+	receipt, _ := registry.backend.TransactionReceipt(context.Background(), tx.Hash())
+	if receipt == nil {
+		registry.t.Errorf("%v: expected the transaction to be mined", call)
+	} else if receipt.Status != types.ReceiptStatusSuccessful {
+		registry.t.Errorf("%v: expected the transaction to succeed", call)
+	}
+
+	return tx, err
+}
+
+func (registry *minedRegistry) ApproveRen(value *stackint.Int1024) (*types.Transaction, error) {
+	tx, err := registry.Registry.ApproveRen(value)
+	return registry.mined("approve", tx, err)
+}
+
+func (registry *minedRegistry) Register(darknodeID []byte, publicKey []byte, bond *stackint.Int1024) (*types.Transaction, error) {
+	tx, err := registry.Registry.Register(darknodeID, publicKey, bond)
+	return registry.mined("register", tx, err)
+}
+
+func (registry *minedRegistry) Deregister(darknodeID []byte) (*types.Transaction, error) {
+	tx, err := registry.Registry.Deregister(darknodeID)
+	return registry.mined("deregister", tx, err)
+}
+
+func (registry *minedRegistry) Refund(darknodeID []byte) (*types.Transaction, error) {
+	tx, err := registry.Registry.Refund(darknodeID)
+	return registry.mined("refund", tx, err)
+}
+
+// deploySimulatedRegistry deploys the REN token, the Darknode registry and
+// the reward vault to a simulated backend, and connects to them with a
+// Registry signing transactions with the key of the owner, who holds all REN.
+// Another Darknode is registered, so the pods of the network are never empty.
+// The returned function calls the next epoch.
+func deploySimulatedRegistry(t *testing.T, minimumBond *big.Int) (*minedRegistry, func()) {
+	t.Helper()
+	key, err := ethcrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := bind.NewKeyedTransactor(key)
+	ether := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+	backend := backends.NewSimulatedBackend(core.GenesisAlloc{
+		auth.From: {Balance: new(big.Int).Mul(big.NewInt(1000), ether)},
+	})
+	transact := func(tx *types.Transaction, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		backend.Commit()
+		receipt, err := backend.TransactionReceipt(context.Background(), tx.Hash())
+		if err != nil || receipt.Status != types.ReceiptStatusSuccessful {
+			t.Fatalf("transaction %v failed: %v", tx.Hash().Hex(), err)
+		}
+	}
+
+	tokenAddress, tx, token, err := bindings.DeployRepublicToken(auth, backend)
+	transact(tx, err)
+	registryAddress, tx, darknodeRegistry, err := bindings.DeployDarknodeRegistry(auth, backend, tokenAddress, minimumBond, big.NewInt(1), big.NewInt(0))
+	transact(tx, err)
+	rewardVaultAddress, tx, _, err := bindings.DeployRewardVault(auth, backend, registryAddress)
+	transact(tx, err)
+	// The registry switches to the next parameters at every epoch, and the
+	// constructor only sets the current ones.
+	transact(darknodeRegistry.UpdateMinimumBond(auth, minimumBond))
+	transact(darknodeRegistry.UpdateMinimumPodSize(auth, big.NewInt(1)))
+	nextEpoch := func() {
+		t.Helper()
+		transact(darknodeRegistry.Epoch(auth))
+	}
+
+	other := testConfig(t)
+	publicKey, err := crypto.BytesFromRsaPublicKey(&other.Keystore.RsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var otherID [20]byte
+	copy(otherID[:], other.Address.ID())
+	transact(token.Approve(auth, registryAddress, minimumBond))
+	transact(darknodeRegistry.Register(auth, otherID, publicKey, minimumBond))
+	nextEpoch()
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", &SimulatedEthereum{backend}); err != nil {
+		t.Fatal(err)
+	}
+	conn := contract.Conn{
+		Client: ethclient.NewClient(rpc.DialInProc(server)),
+		Config: contract.Config{
+			Network:                 contract.NetworkTestnet,
+			RepublicTokenAddress:    tokenAddress.Hex(),
+			DarknodeRegistryAddress: registryAddress.Hex(),
+			RewardVaultAddress:      rewardVaultAddress.Hex(),
+		},
+	}
+	registry, err := bindRegistry(conn, auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &minedRegistry{Registry: registry, t: t, backend: backend}, nextEpoch
+}
+
+func TestRegistryOnSimulatedBackend(t *testing.T) {
+	defer useTempDirectory(t)()
+	writeFakeNode(t, "node", "server")
+	cfg := testConfig(t)
+	minimumBond := big.NewInt(100000)
+	registry, nextEpoch := deploySimulatedRegistry(t, minimumBond)
+
+	// The Darknode is registered at the next epoch once the bond has been
+	// approved and the registration has been mined.
+	if err := registerDarknode(registry, "node", cfg); err != nil {
+		t.Fatal(err)
+	}
+	nextEpoch()
+	if registered, err := registry.IsRegistered(cfg.Address); err != nil || !registered {
+		t.Fatalf("expected the Darknode to be registered, got %v, %v", registered, err)
+	}
+	bond, err := registry.GetBond(cfg.Address.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bond.ToBigInt().Cmp(minimumBond) != 0 {
+		t.Errorf("expected the bond %v, got %v", minimumBond, bond.ToBigInt())
+	}
+	if fees, err := registry.PendingFees(cfg.Address.ID()); err != nil || fees.Sign() != 0 {
+		t.Errorf("expected no pending fees, got %v, %v", fees, err)
+	}
+	if err := checkDarknodeRefunded(registry, "node", cfg); err == nil {
+		t.Error("expected a registered Darknode not to be refunded")
+	}
+
+	// The refund is pending until the deregistration has completed, and is
+	// made in the first epoch it becomes callable.
+	deregistered, err := deregisterDarknode(registry, "node", cfg)
+	if err != nil || !deregistered {
+		t.Fatalf("expected the Darknode to be deregistered, got %v, %v", deregistered, err)
+	}
+	pending, err := recordPendingRefund(registry, "node", cfg)
+	if err != nil || !pending {
+		t.Fatalf("expected a pending refund, got %v, %v", pending, err)
+	}
+	refunded := false
+	for i := 0; i < 3 && !refunded; i++ {
+		nextEpoch()
+		if refunded, err = tryPendingRefund(registry, "node", cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !refunded {
+		t.Fatal("expected the bond to be refunded")
+	}
+	if err := checkDarknodeRefunded(registry, "node", cfg); err != nil {
+		t.Error(err)
+	}
+	node, err := LoadNode("node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.Pending != nil {
+		t.Errorf("expected the pending refund to be cleared, got %v", node.Pending)
+	}
+
+	if expected := []string{"approve", "register", "deregister", "refund"}; !equalCalls(registry.calls, expected) {
+		t.Errorf("expected the transactions %v, got %v", expected, registry.calls)
+	}
+}
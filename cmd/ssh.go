@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// SSHTimeout is the maximum time to wait for establishing a ssh connection.
+const SSHTimeout = 30 * time.Second
+
+// sshPort is the port of the ssh server on the Darknodes.
+var sshPort = "22"
+
+// RemoteError is returned when a command exits with a non-zero status on the
+// Darknode.
+type RemoteError struct {
+	Name       string
+	Command    string
+	ExitStatus int
+}
+
+// Error implements the error interface.
+func (err RemoteError) Error() string {
+	command := strings.TrimSpace(err.Command)
+	if i := strings.Index(command, "\n"); i != -1 {
+		command = command[:i] + " ..."
+	}
+	return fmt.Sprintf("%s[%s] command %q exited with status %d%s", RED, err.Name, command, err.ExitStatus, RESET)
+}
+
+// SSHClient runs commands and uploads files on a Darknode over ssh.
+type SSHClient struct {
+	name   string
+	client *ssh.Client
+}
+
+// DialNode connects to the Darknode with the given name as the ubuntu user,
+// using the ssh key pair of the Darknode. The connection is rejected unless
+// the Darknode presents its pinned host key.
+func DialNode(name string) (*SSHClient, error) {
+	hostKeyCallback, err := trustedHostKey(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return dialNode(name, hostKeyCallback)
+}
+
+// dialNode connects to the Darknode with the given name, verifying its host
+// key with the callback.
+func dialNode(name string, hostKeyCallback ssh.HostKeyCallback) (*SSHClient, error) {
+	node, err := LoadNode(name)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := readSigner(NodeDirectory(name) + "/ssh_keypair")
+	if err != nil {
+		return nil, err
+	}
+
+	return DialSSH(name, node.IP, "ubuntu", ssh.PublicKeys(signer), hostKeyCallback)
+}
+
+// DialSSH connects to the host as the user with the given authentication
+// method, verifying the host key with the callback. The name is used to
+// prefix the output of remote commands.
+func DialSSH(name, host, user string, auth ssh.AuthMethod, hostKeyCallback ssh.HostKeyCallback) (*SSHClient, error) {
+	config := &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         SSHTimeout,
+	}
+	client, err := ssh.Dial("tcp", net.JoinHostPort(host, sshPort), config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SSHClient{
+		name:   name,
+		client: client,
+	}, nil
+}
+
+// Close the connection to the Darknode.
+func (client *SSHClient) Close() error {
+	return client.client.Close()
+}
+
+// Run the script on the Darknode. The output of the script is streamed to the
+// standard output with the name of the Darknode as a prefix.
+func (client *SSHClient) Run(script string) error {
+	return client.RunWithInput(script, nil)
+}
+
+// RunWithInput runs the script on the Darknode with the given standard input.
+func (client *SSHClient) RunWithInput(script string, stdin io.Reader) error {
+	session, err := client.client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	stdout := newPrefixWriter(client.name, os.Stdout)
+	stderr := newPrefixWriter(client.name, os.Stderr)
+	defer stdout.Flush()
+	defer stderr.Flush()
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = stderr
+
+	return client.remoteError(script, session.Run(script))
+}
+
+// Output runs the script on the Darknode and returns its standard output.
+// The output is returned even if the script exits with a non-zero status.
+func (client *SSHClient) Output(script string) (string, error) {
+	session, err := client.client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	output, err := session.Output(script)
+	return string(output), client.remoteError(script, err)
+}
+
+// Upload copies the local file or directory to the remote path on the
+// Darknode, preserving its permissions.
+func (client *SSHClient) Upload(local, remote string) error {
+	info, err := os.Stat(local)
+	if err != nil {
+		return err
+	}
+	command := "scp -t " + shellQuote(remote)
+	if info.IsDir() {
+		command = "scp -rt " + shellQuote(remote)
+	}
+
+	return client.scp(command, func(w io.Writer, r *bufio.Reader) error {
+		return scpSend(w, r, local, info)
+	})
+}
+
+// UploadBytes writes the data to the remote path on the Darknode with the
+// given permissions. The data never appears in the arguments of a remote
+// process.
+func (client *SSHClient) UploadBytes(data []byte, remote string, perm os.FileMode) error {
+	return client.scp("scp -t "+shellQuote(remote), func(w io.Writer, r *bufio.Reader) error {
+		return scpSendFile(w, r, filepath.Base(remote), perm, int64(len(data)), bytes.NewReader(data))
+	})
+}
+
+// scp starts the scp sink on the Darknode and sends files using the scp
+// protocol.
+func (client *SSHClient) scp(command string, send func(w io.Writer, r *bufio.Reader) error) error {
+	session, err := client.client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr := newPrefixWriter(client.name, os.Stderr)
+	defer stderr.Flush()
+	session.Stderr = stderr
+	if err := session.Start(command); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(stdout)
+	if err := scpAck(reader); err != nil {
+		return err
+	}
+	if err := send(stdin, reader); err != nil {
+		stdin.Close()
+		return err
+	}
+	if err := stdin.Close(); err != nil {
+		return err
+	}
+
+	return client.remoteError(command, session.Wait())
+}
+
+// remoteError converts the exit status of a remote command into a
+// RemoteError.
+func (client *SSHClient) remoteError(command string, err error) error {
+	switch err := err.(type) {
+	case nil:
+		return nil
+	case *ssh.ExitError:
+		return RemoteError{
+			Name:       client.name,
+			Command:    command,
+			ExitStatus: err.ExitStatus(),
+		}
+	case *ssh.ExitMissingError:
+		return RemoteError{
+			Name:       client.name,
+			Command:    command,
+			ExitStatus: -1,
+		}
+	default:
+		return err
+	}
+}
+
+// scpSend sends the file or the directory using the scp protocol.
+func scpSend(w io.Writer, r *bufio.Reader, local string, info os.FileInfo) error {
+	if !info.IsDir() {
+		file, err := os.Open(local)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		return scpSendFile(w, r, info.Name(), info.Mode().Perm(), info.Size(), file)
+	}
+
+	if _, err := fmt.Fprintf(w, "D%04o 0 %s\n", info.Mode().Perm(), info.Name()); err != nil {
+		return err
+	}
+	if err := scpAck(r); err != nil {
+		return err
+	}
+	files, err := ioutil.ReadDir(local)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := scpSend(w, r, filepath.Join(local, f.Name()), f); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprint(w, "E\n"); err != nil {
+		return err
+	}
+
+	return scpAck(r)
+}
+
+// scpSendFile sends a single file using the scp protocol.
+func scpSendFile(w io.Writer, r *bufio.Reader, name string, perm os.FileMode, size int64, data io.Reader) error {
+	if _, err := fmt.Fprintf(w, "C%04o %d %s\n", perm, size, name); err != nil {
+		return err
+	}
+	if err := scpAck(r); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(w, data, size); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{0}); err != nil {
+		return err
+	}
+
+	return scpAck(r)
+}
+
+// scpAck reads the response of the scp sink.
+func scpAck(r *bufio.Reader) error {
+	code, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if code == 0 {
+		return nil
+	}
+	message, _ := r.ReadString('\n')
+	return fmt.Errorf("scp: %s", strings.TrimSpace(message))
+}
+
+// readSigner reads the private key file. Encrypted keys are not supported
+// unless they have been added to the ssh agent.
+func readSigner(keyFile string) (ssh.Signer, error) {
+	data, err := readSecret(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return ssh.ParsePrivateKey(data)
+}
+
+// keyFileAuth returns an authentication method using the private key file,
+// falling back to the ssh agent if the key cannot be parsed.
+func keyFileAuth(keyFile string) (ssh.AuthMethod, error) {
+	signer, err := readSigner(keyFile)
+	if err == nil {
+		return ssh.PublicKeys(signer), nil
+	}
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, err
+	}
+	conn, dialErr := net.Dial("unix", socket)
+	if dialErr != nil {
+		return nil, err
+	}
+
+	return ssh.PublicKeysCallback(agent.NewClient(conn).Signers), nil
+}
+
+// shellQuote quotes the string for safe use as a single shell word.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// outputMu prevents lines from different Darknodes being interleaved.
+var outputMu = new(sync.Mutex)
+
+// prefixWriter writes complete lines to the underlying writer with a prefix.
+type prefixWriter struct {
+	prefix string
+	w      io.Writer
+	buf    []byte
+}
+
+func newPrefixWriter(name string, w io.Writer) *prefixWriter {
+	return &prefixWriter{
+		prefix: fmt.Sprintf("[%s] ", name),
+		w:      w,
+	}
+}
+
+// Write implements the io.Writer interface.
+func (writer *prefixWriter) Write(p []byte) (int, error) {
+	writer.buf = append(writer.buf, p...)
+	for {
+		i := bytes.IndexByte(writer.buf, '\n')
+		if i == -1 {
+			break
+		}
+		if err := writer.writeLine(writer.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		writer.buf = writer.buf[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// Flush writes the remaining incomplete line.
+func (writer *prefixWriter) Flush() error {
+	if len(writer.buf) == 0 {
+		return nil
+	}
+	line := append(writer.buf, '\n')
+	writer.buf = nil
+	return writer.writeLine(line)
+}
+
+func (writer *prefixWriter) writeLine(line []byte) error {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+
+	_, err := fmt.Fprintf(writer.w, "%s%s", writer.prefix, line)
+	return err
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// testServer is an in-process ssh server. It runs `echo`, `exit` and the scp
+// sink, and keeps the uploaded files in memory.
+type testServer struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+
+	mu    sync.Mutex
+	files map[string]string
+}
+
+// newTestServer starts a ssh server with a new host key on a random port of
+// the loopback interface and points sshPort to it.
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	hostKey, err := ssh.NewSignerFromKey(newTestKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return newTestServerWithHostKey(t, hostKey)
+}
+
+// newTestServerWithHostKey starts a ssh server presenting the host key.
+func newTestServerWithHostKey(t *testing.T, hostKey ssh.Signer) *testServer {
+	t.Helper()
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostKey)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, sshPort, _ = net.SplitHostPort(listener.Addr().String())
+
+	server := &testServer{
+		listener: listener,
+		config:   config,
+		files:    map[string]string{},
+	}
+	go server.serve()
+
+	return server
+}
+
+// Close stops accepting connections and restores sshPort.
+func (server *testServer) Close() {
+	server.listener.Close()
+	sshPort = "22"
+}
+
+func (server *testServer) File(path string) (string, bool) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	data, ok := server.files[path]
+	return data, ok
+}
+
+func (server *testServer) serve() {
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			_, channels, requests, err := ssh.NewServerConn(conn, server.config)
+			if err != nil {
+				conn.Close()
+				return
+			}
+			go ssh.DiscardRequests(requests)
+			for newChannel := range channels {
+				if newChannel.ChannelType() != "session" {
+					newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+					continue
+				}
+				channel, requests, err := newChannel.Accept()
+				if err != nil {
+					continue
+				}
+				go server.session(channel, requests)
+			}
+		}()
+	}
+}
+
+func (server *testServer) session(channel ssh.Channel, requests <-chan *ssh.Request) {
+	for req := range requests {
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+		var exec struct{ Command string }
+		if err := ssh.Unmarshal(req.Payload, &exec); err != nil {
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+		go func() {
+			status := server.exec(channel, exec.Command)
+			channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+			channel.Close()
+		}()
+	}
+}
+
+func (server *testServer) exec(channel ssh.Channel, command string) uint32 {
+	args := strings.Fields(command)
+	switch {
+	case len(args) == 2 && args[0] == "echo":
+		fmt.Fprintln(channel, args[1])
+		return 0
+	case len(args) == 2 && args[0] == "exit":
+		status, _ := strconv.Atoi(args[1])
+		return uint32(status)
+	case len(args) == 3 && args[0] == "scp":
+		target := strings.Trim(args[2], "'")
+		if err := server.scpSink(channel, target, args[1] == "-rt"); err != nil {
+			return 1
+		}
+		return 0
+	default:
+		return 127
+	}
+}
+
+// scpSink receives files using the scp protocol. Files named `denied` are
+// rejected with an error reply.
+func (server *testServer) scpSink(channel ssh.Channel, target string, recursive bool) error {
+	r := bufio.NewReader(channel)
+	dirs := []string{}
+	channel.Write([]byte{0})
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var perm, size int64
+		var name string
+		switch line[0] {
+		case 'D', 'C':
+			if _, err := fmt.Sscanf(line[1:], "%o %d %s", &perm, &size, &name); err != nil {
+				return err
+			}
+		case 'E':
+			dirs = dirs[:len(dirs)-1]
+			channel.Write([]byte{0})
+			continue
+		default:
+			return fmt.Errorf("unexpected scp message %q", line)
+		}
+		if name == "denied" {
+			fmt.Fprintf(channel, "\x01scp: %s: Permission denied\n", name)
+			return fmt.Errorf("permission denied")
+		}
+		destination := target
+		if recursive || len(dirs) > 0 {
+			destination = path.Join(append(append([]string{target}, dirs...), name)...)
+		}
+		if line[0] == 'D' {
+			dirs = append(dirs, name)
+			channel.Write([]byte{0})
+			continue
+		}
+		channel.Write([]byte{0})
+		data := make([]byte, size+1)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return err
+		}
+		server.mu.Lock()
+		server.files[destination] = string(data[:size])
+		server.mu.Unlock()
+		channel.Write([]byte{0})
+	}
+}
+
+func newTestKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+// writeTestNode creates a Darknode on the loopback interface with a new ssh
+// key pair.
+func writeTestNode(t *testing.T, name string) {
+	t.Helper()
+	if err := os.MkdirAll(NodeDirectory(name), 0700); err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(newTestKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPair := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	if err := ioutil.WriteFile(NodeDirectory(name)+"/ssh_keypair", keyPair, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveNode(Node{Name: name, Provider: "server", Network: "testnet", IP: "127.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// dialTestNode creates a Darknode, pins the host key of the server on the
+// first connection like a provisioned server, and connects to it.
+func dialTestNode(t *testing.T, name string) *SSHClient {
+	t.Helper()
+	writeTestNode(t, name)
+	client, err := dialNode(name, recordHostKey(NodeDirectory(name)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	client, err = DialNode(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+func TestSSHExitStatus(t *testing.T) {
+	defer useTempDirectory(t)()
+	server := newTestServer(t)
+	defer server.Close()
+	client := dialTestNode(t, "node")
+	defer client.Close()
+
+	output, err := client.Output("echo hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "hello\n" {
+		t.Errorf("expected output %q, got %q", "hello\n", output)
+	}
+
+	tests := []struct {
+		command string
+		status  int
+	}{
+		{"exit 0", 0},
+		{"exit 1", 1},
+		{"exit 42", 42},
+		{"unknown command", 127},
+	}
+	for _, test := range tests {
+		err := client.Run(test.command)
+		if test.status == 0 {
+			if err != nil {
+				t.Errorf("%q: unexpected error %v", test.command, err)
+			}
+			continue
+		}
+		remoteErr, ok := err.(RemoteError)
+		if !ok {
+			t.Errorf("%q: expected a RemoteError, got %v", test.command, err)
+			continue
+		}
+		if remoteErr.Name != "node" || remoteErr.Command != test.command || remoteErr.ExitStatus != test.status {
+			t.Errorf("%q: expected exit status %d, got %+v", test.command, test.status, remoteErr)
+		}
+	}
+}
+
+func TestSSHUpload(t *testing.T) {
+	defer useTempDirectory(t)()
+	server := newTestServer(t)
+	defer server.Close()
+	client := dialTestNode(t, "node")
+	defer client.Close()
+
+	local, err := ioutil.TempDir("", "darknode-cli-upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(local)
+	if err := os.MkdirAll(local+"/provisions/scripts", 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(local+"/config.json", []byte(`{"port":"18514"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(local+"/provisions/scripts/up.sh", []byte("echo up\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Upload(local+"/config.json", "/home/ubuntu/darknode-config.json"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Upload(local+"/provisions", "/home/ubuntu"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.UploadBytes([]byte("secret"), "/home/ubuntu/secret", 0600); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"/home/ubuntu/darknode-config.json":     `{"port":"18514"}`,
+		"/home/ubuntu/provisions/scripts/up.sh": "echo up\n",
+		"/home/ubuntu/secret":                   "secret",
+	}
+	for file, expected := range files {
+		data, ok := server.File(file)
+		if !ok {
+			t.Errorf("%v has not been uploaded", file)
+			continue
+		}
+		if data != expected {
+			t.Errorf("expected %v to contain %q, got %q", file, expected, data)
+		}
+	}
+
+	err = client.UploadBytes([]byte("secret"), "/home/ubuntu/denied", 0600)
+	if err == nil || !strings.Contains(err.Error(), "Permission denied") {
+		t.Errorf("expected the scp error reply, got %v", err)
+	}
+}
+
+func TestSSHHostKeyChanged(t *testing.T) {
+	defer useTempDirectory(t)()
+	server := newTestServer(t)
+	client := dialTestNode(t, "node")
+	client.Close()
+	server.Close()
+
+	if _, err := readHostKey(NodeDirectory("node")); err != nil {
+		t.Fatalf("the host key has not been pinned: %v", err)
+	}
+
+	// The same address presents another host key.
+	server = newTestServer(t)
+	defer server.Close()
+	_, err := DialNode("node")
+	if err == nil || !strings.Contains(err.Error(), "has changed") {
+		t.Fatalf("expected the changed host key to be rejected, got %v", err)
+	}
+
+	writeTestNode(t, "other")
+	if _, err := DialNode("other"); err == nil || !strings.Contains(err.Error(), "is not trusted") {
+		t.Fatalf("expected an untrusted host key to be rejected, got %v", err)
+	}
+}
+
+func TestNewHostKey(t *testing.T) {
+	defer useTempDirectory(t)()
+	writeTestNode(t, "node")
+	authorizedKey, err := newHostKey(NodeDirectory("node"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinned, err := readHostKey(NodeDirectory("node"))
+	if err != nil {
+		t.Fatalf("the host key has not been pinned: %v", err)
+	}
+	if strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pinned))) != authorizedKey {
+		t.Fatalf("expected the pinned host key %q, got %q", authorizedKey, ssh.MarshalAuthorizedKey(pinned))
+	}
+
+	// The instance installs the private key from the user data and is trusted
+	// on the first connection.
+	userData, err := ioutil.ReadFile(NodeDirectory("node") + "/user_data.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(userData), "#cloud-config\n") || !strings.Contains(string(userData), "ecdsa_public: "+authorizedKey+"\n") {
+		t.Fatalf("unexpected user data %q", userData)
+	}
+	lines := strings.Split(string(userData), "\n")
+	privateKey := []string{}
+	for _, line := range lines {
+		if strings.HasPrefix(line, "    ") {
+			privateKey = append(privateKey, strings.TrimPrefix(line, "    "))
+		}
+	}
+	hostKey, err := ssh.ParsePrivateKey([]byte(strings.Join(privateKey, "\n")))
+	if err != nil {
+		t.Fatalf("cannot parse the private host key in the user data: %v", err)
+	}
+	server := newTestServerWithHostKey(t, hostKey)
+	defer server.Close()
+	client, err := DialNode("node")
+	if err != nil {
+		t.Fatalf("expected the first connection to be trusted, got %v", err)
+	}
+	client.Close()
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/republicprotocol/republic-go/contract"
+	"github.com/republicprotocol/republic-go/dispatch"
+	"github.com/republicprotocol/republic-go/identity"
+)
+
+// StatusPort is the port of the status endpoint of a Darknode.
+const StatusPort = 18515
+
+// Unknown is shown for the parts of the status which cannot be probed.
+const Unknown = "unknown"
+
+// statusResponse is the part of the response of the status endpoint used by
+// the CLI.
+type statusResponse struct {
+	Peers int `json:"peers"`
+}
+
+// NodeStatus is the live status of a Darknode.
+type NodeStatus struct {
+	Reachable    string
+	Service      string
+	Commit       string
+	Peers        string
+	Registration string
+}
+
+// probeNodes probes all Darknodes concurrently. Each Darknode is given at
+// most the timeout to respond, including the connection to its Darknode
+// registry, so unreachable Darknodes and networks don't block the others.
+func probeNodes(nodes []Node, timeout time.Duration) []NodeStatus {
+	registries := newRegistryConnections()
+	statuses := make([]NodeStatus, len(nodes))
+	dispatch.CoForAll(nodes, func(i int) {
+		statuses[i] = probeNode(nodes[i], registries, timeout)
+	})
+
+	return statuses
+}
+
+// probeNode probes the Darknode over ssh, its status endpoint and the
+// Darknode registry at the same time.
+func probeNode(node Node, registries *registryConnections, timeout time.Duration) NodeStatus {
+	status := NodeStatus{
+		Reachable:    "timeout",
+		Service:      Unknown,
+		Commit:       Unknown,
+		Peers:        Unknown,
+		Registration: Unknown,
+	}
+
+	type sshResult struct {
+		service, commit string
+		err             error
+	}
+	sshResults := make(chan sshResult, 1)
+	go func() {
+		service, commit, err := probeSSH(node.Name)
+		sshResults <- sshResult{service, commit, err}
+	}()
+	peerResults := make(chan string, 1)
+	go func() {
+		peerResults <- probePeers(node.IP, timeout)
+	}()
+	registrationResults := make(chan string, 1)
+	go func() {
+		registrationResults <- probeRegistration(node, registries.Connect(node.Name))
+	}()
+
+	deadline := time.After(timeout)
+	for pending := 3; pending > 0; pending-- {
+		select {
+		case result := <-sshResults:
+			if result.err != nil {
+				status.Reachable = "no"
+				continue
+			}
+			status.Reachable = "yes"
+			status.Service = result.service
+			status.Commit = result.commit
+		case peers := <-peerResults:
+			status.Peers = peers
+		case registration := <-registrationResults:
+			status.Registration = registration
+		case <-deadline:
+			return status
+		}
+	}
+
+	return status
+}
+
+// probeSSH returns the state of the darknode service and the commit of the
+// software running on the Darknode.
+func probeSSH(name string) (string, string, error) {
+	client, err := DialNode(name)
+	if err != nil {
+		return "", "", err
+	}
+	defer client.Close()
+
+	// systemctl exits with a non-zero code when the service is not active,
+	// so the output is preferred over the error.
+	output, _ := client.Output(`systemctl is-active darknode; cd $HOME/go/src/github.com/republicprotocol/republic-go && git rev-parse --short HEAD`)
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	service, commit := Unknown, Unknown
+	if len(lines) > 0 && lines[0] != "" {
+		service = strings.TrimSpace(lines[0])
+	}
+	if len(lines) > 1 {
+		commit = strings.TrimSpace(lines[1])
+	}
+
+	return service, commit, nil
+}
+
+// probePeers returns the number of peers reported by the status endpoint of
+// the Darknode.
+func probePeers(ip string, timeout time.Duration) string {
+	client := http.Client{Timeout: timeout}
+	response, err := client.Get(fmt.Sprintf("http://%v:%v/status", ip, StatusPort))
+	if err != nil {
+		return Unknown
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return Unknown
+	}
+	status := statusResponse{}
+	if err := json.NewDecoder(response.Body).Decode(&status); err != nil {
+		return Unknown
+	}
+
+	return fmt.Sprintf("%d", status.Peers)
+}
+
+// probeRegistration returns whether the Darknode is registered in the
+// Darknode registry.
+func probeRegistration(node Node, registry Registry) string {
+	if registry == nil {
+		return Unknown
+	}
+	address, err := node.Address()
+	if err != nil {
+		return Unknown
+	}
+	registered, err := registry.IsRegistered(identity.Address(address))
+	if err != nil {
+		return Unknown
+	}
+	if registered {
+		return "registered"
+	}
+
+	return "unregistered"
+}
+
+// registryConnections connects to the Darknode registry of each network used
+// by the Darknodes. Each network is dialed once, when the first of its
+// Darknodes asks for the registry, so the Darknodes can connect concurrently.
+type registryConnections struct {
+	mu          sync.Mutex
+	connections map[contract.Config]*registryConnection
+}
+
+// registryConnection is the connection to the Darknode registry of a single
+// network.
+type registryConnection struct {
+	once     sync.Once
+	registry Registry
+}
+
+func newRegistryConnections() *registryConnections {
+	return &registryConnections{
+		connections: map[contract.Config]*registryConnection{},
+	}
+}
+
+// Connect returns the Darknode registry of the network of the Darknode. It
+// returns nil if the network cannot be reached.
+func (registries *registryConnections) Connect(name string) Registry {
+	cfg, err := loadConfig(name)
+	if err != nil {
+		return nil
+	}
+	registries.mu.Lock()
+	connection, ok := registries.connections[cfg.Ethereum]
+	if !ok {
+		connection = new(registryConnection)
+		registries.connections[cfg.Ethereum] = connection
+	}
+	registries.mu.Unlock()
+
+	connection.once.Do(func() {
+		registry, err := connectRegistry(cfg.Ethereum, &bind.TransactOpts{})
+		if err == nil {
+			connection.registry = registry
+		}
+	})
+
+	return connection.registry
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/republicprotocol/republic-go/contract"
+)
+
+func TestProbeNodesTimeout(t *testing.T) {
+	defer useTempDirectory(t)()
+
+	// The Ethereum node never responds, so the websocket handshake of the
+	// connection to the Darknode registry hangs.
+	hang := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hang
+	}))
+	defer server.Close()
+	defer close(hang)
+
+	names := []string{"node-1", "node-2", "node-3"}
+	for _, name := range names {
+		writeFakeNode(t, name, "server")
+		cfg := testConfig(t)
+		cfg.Ethereum = contract.Config{Network: contract.NetworkTestnet, URI: "ws" + strings.TrimPrefix(server.URL, "http")}
+		data, err := json.Marshal(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(NodeDirectory(name)+"/config.json", data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	nodes := make([]Node, len(names))
+	for i, name := range names {
+		node, err := LoadNode(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes[i] = node
+	}
+
+	timeout := 200 * time.Millisecond
+	start := time.Now()
+	statuses := probeNodes(nodes, timeout)
+	if elapsed := time.Since(start); elapsed > 5*timeout {
+		t.Errorf("expected the probes to finish within the timeout of %v, took %v", timeout, elapsed)
+	}
+	for i, status := range statuses {
+		if status.Registration != Unknown {
+			t.Errorf("%v: expected the registration %v, got %v", names[i], Unknown, status.Registration)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/republicprotocol/republic-go/identity"
+)
+
+// NodeVersion is the current version of the node.json format. Version 2
+// removed the cloud credentials from the terraform config of the Darknode.
+const NodeVersion = 2
+
+// Node contains the metadata of a deployed Darknode. It is stored as
+// node.json in the directory of the Darknode.
+type Node struct {
+	Version      int       `json:"version"`
+	Name         string    `json:"name"`
+	Provider     string    `json:"provider"`
+	Region       string    `json:"region,omitempty"`
+	Instance     string    `json:"instance,omitempty"`
+	Network      string    `json:"network"`
+	Branch       string    `json:"branch"`
+	CreatedAt    time.Time `json:"createdAt"`
+	Tags         []string  `json:"tags"`
+	IP           string    `json:"ip,omitempty"`
+	MultiAddress string    `json:"multiAddress,omitempty"`
+
+	// Profile is the name of the credential profile the Darknode was
+	// deployed with, which is used to manage it afterwards.
+	Profile string `json:"profile,omitempty"`
+
+	// CredentialsFile is the path of the GCP service account key file the
+	// Darknode was deployed with. The key itself is never copied.
+	CredentialsFile string `json:"credentialsFile,omitempty"`
+
+	// AwsProfile, AwsRoleArn and AwsMfaSerial are the shared AWS profile and
+	// the IAM role the Darknode was deployed with, if it was not deployed
+	// with a credential profile.
+	AwsProfile   string `json:"awsProfile,omitempty"`
+	AwsRoleArn   string `json:"awsRoleArn,omitempty"`
+	AwsMfaSerial string `json:"awsMfaSerial,omitempty"`
+
+	// ServerLogin and ServerKey are the user and the private key file used to
+	// provision an existing server. ServerUser and ServerSudoers record
+	// whether provisioning created the ubuntu user and its sudoers file, so
+	// destroying the Darknode removes them again.
+	ServerLogin   string `json:"serverLogin,omitempty"`
+	ServerKey     string `json:"serverKey,omitempty"`
+	ServerUser    bool   `json:"serverUser,omitempty"`
+	ServerSudoers bool   `json:"serverSudoers,omitempty"`
+
+	// Pending is an on-chain action which has been started but can only be
+	// finished in a later epoch.
+	Pending *PendingAction `json:"pending,omitempty"`
+}
+
+// PendingAction is an on-chain action waiting for epochs to pass.
+type PendingAction struct {
+	Action    string    `json:"action"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Epoch is the block number of the epoch in which the action was
+	// started.
+	Epoch uint `json:"epoch"`
+
+	// AttemptedEpoch is the block number of the last epoch in which the
+	// action was attempted without success.
+	AttemptedEpoch uint `json:"attemptedEpoch,omitempty"`
+}
+
+// SetMultiAddress parses the multiAddress and sets both the multiAddress and
+// the IP address of the Darknode.
+func (node *Node) SetMultiAddress(multiAddress string) error {
+	multi, err := identity.NewMultiAddressFromString(strings.TrimSpace(multiAddress))
+	if err != nil {
+		return err
+	}
+	ip, err := multi.ValueForProtocol(identity.IP4Code)
+	if err != nil {
+		return err
+	}
+	node.IP = ip
+	node.MultiAddress = multi.String()
+
+	return nil
+}
+
+// Address returns the Republic address of the Darknode.
+func (node Node) Address() (string, error) {
+	multi, err := identity.NewMultiAddressFromString(node.MultiAddress)
+	if err != nil {
+		return "", err
+	}
+
+	return multi.ValueForProtocol(identity.RepublicCode)
+}
+
+// NodeDirectory returns the directory of the Darknode with the given name.
+func NodeDirectory(name string) string {
+	return Directory + "/darknodes/" + name
+}
+
+// LoadNode reads the metadata of the Darknode with the given name. Darknodes
+// deployed before node.json existed are migrated on the first read. The
+// terraform config of older Darknodes is only upgraded by upgradeNode.
+func LoadNode(name string) (Node, error) {
+	nodeDirectory := NodeDirectory(name)
+	if _, err := os.Stat(nodeDirectory); os.IsNotExist(err) {
+		return Node{}, ErrNoDeploymentFound
+	}
+
+	data, err := ioutil.ReadFile(nodeDirectory + "/node.json")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return migrateNode(name)
+		}
+		return Node{}, err
+	}
+	node := Node{}
+	if err := json.Unmarshal(data, &node); err != nil {
+		return Node{}, err
+	}
+	if node.Version > NodeVersion {
+		return Node{}, fmt.Errorf("%s[%s] was created by a newer version of the Darknode CLI%s", RED, name, RESET)
+	}
+
+	return node, nil
+}
+
+// upgradeNode reads the metadata of the Darknode with the given name and
+// upgrades a Darknode deployed by an older version of the CLI to the current
+// version. It is called before terraform manages the Darknode, never by
+// commands which only read the Darknode.
+func upgradeNode(name string) (Node, error) {
+	node, err := LoadNode(name)
+	if err != nil {
+		return Node{}, err
+	}
+	if node.Version < NodeVersion {
+		return scrubTerraformConfig(node)
+	}
+
+	return node, nil
+}
+
+// SaveNode writes the metadata of the Darknode into its directory. New
+// Darknodes get the current version, others keep their version until they
+// are upgraded.
+func SaveNode(node Node) error {
+	if node.Version == 0 {
+		node.Version = NodeVersion
+	}
+	node.Tags = normalizeTags(node.Tags)
+	data, err := json.MarshalIndent(node, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(NodeDirectory(node.Name)+"/node.json", data, 0600)
+}
+
+// LoadAllNodes reads the metadata of all Darknodes, sorted by their names.
+// Darknodes which cannot be read are reported and skipped.
+func LoadAllNodes() ([]Node, error) {
+	files, err := ioutil.ReadDir(Directory + "/darknodes")
+	if err != nil {
+		return nil, err
+	}
+	nodes := []Node{}
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+		node, err := LoadNode(f.Name())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%scannot read [%s]: %v%s\n", RED, f.Name(), err, RESET)
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
+	})
+
+	return nodes, nil
+}
+
+// NetworkBranch returns the release branch used by Darknodes on the network,
+// or the InstallBranch if the network is unknown.
+func NetworkBranch(network string) string {
+	definition, err := LoadNetwork(network)
+	if err != nil {
+		return InstallBranch
+	}
+
+	return definition.Branch
+}
+
+// migrateNode converts the tags.out, provider.out and multiAddress.out files
+// of a Darknode deployed by an older version of the CLI into node.json.
+func migrateNode(name string) (Node, error) {
+	nodeDirectory := NodeDirectory(name)
+	info, err := os.Stat(nodeDirectory)
+	if err != nil {
+		return Node{}, err
+	}
+	node := Node{
+		Version:   1,
+		Name:      name,
+		Provider:  "aws",
+		CreatedAt: info.ModTime(),
+		Tags:      []string{},
+	}
+
+	data, err := ioutil.ReadFile(nodeDirectory + "/provider.out")
+	if err == nil {
+		node.Provider = strings.TrimSpace(string(data))
+	}
+	data, err = ioutil.ReadFile(nodeDirectory + "/tags.out")
+	if err == nil {
+		node.Tags = parseTags(string(data))
+	}
+	data, err = ioutil.ReadFile(nodeDirectory + "/multiAddress.out")
+	if err != nil {
+		return Node{}, err
+	}
+	if err := node.SetMultiAddress(string(data)); err != nil {
+		return Node{}, err
+	}
+	cfg, err := loadConfig(name)
+	if err != nil {
+		return Node{}, err
+	}
+	node.Network = string(cfg.Ethereum.Network)
+	node.Branch = NetworkBranch(node.Network)
+
+	// Recover the region and the instance type from the terraform config.
+	data, err = readSecret(nodeDirectory + "/main.tf")
+	if err == nil {
+		node.Region = terraformValue(data, "region")
+		switch node.Provider {
+		case "aws":
+			node.Instance = terraformValue(data, "ec2_instance_type")
+		case "digitalocean":
+			node.Instance = terraformValue(data, "droplet_size")
+		case "gcp":
+			node.Region = terraformValue(data, "zone")
+			node.Instance = terraformValue(data, "machine_type")
+		}
+	}
+
+	if err := SaveNode(node); err != nil {
+		return Node{}, err
+	}
+	for _, file := range []string{"provider.out", "tags.out", "multiAddress.out"} {
+		if err := os.Remove(nodeDirectory + "/" + file); err != nil && !os.IsNotExist(err) {
+			return Node{}, err
+		}
+	}
+
+	return node, nil
+}
+
+// terraformCredentialVariables and terraformCredentialArguments match the
+// variables and module arguments which older versions of the CLI used to
+// write the cloud credentials into main.tf.
+var (
+	terraformCredentialVariables = regexp.MustCompile(`variable "(access_key|secret_key|do_token|credentials)" \{\s*default = "([^"]*)"\s*\}\s*`)
+	terraformCredentialArguments = regexp.MustCompile(`(?m)^\s*(access_key|secret_key|do_token|credentials) = "\$\{var\.\w+\}"\n`)
+)
+
+// scrubTerraformConfig removes the cloud credentials from the terraform config
+// of a Darknode deployed by an older version of the CLI, and saves the
+// node.json with the current version. The credentials are moved into a
+// generated credential profile of the Darknode, and the path of a GCP service
+// account key file is kept in the node.json, so the Darknode is still
+// destroyed with the account which deployed it.
+func scrubTerraformConfig(node Node) (Node, error) {
+	terraformFile := NodeDirectory(node.Name) + "/main.tf"
+	data, err := readSecret(terraformFile)
+	if err != nil && !os.IsNotExist(err) {
+		return Node{}, err
+	}
+	if err == nil {
+		values := map[string]string{}
+		for _, match := range terraformCredentialVariables.FindAllSubmatch(data, -1) {
+			values[string(match[1])] = string(match[2])
+		}
+		switch {
+		case node.Provider == "aws" && values["access_key"] != "":
+			node, err = saveNodeProfile(node, Profile{AccessKey: values["access_key"], SecretKey: values["secret_key"]})
+		case node.Provider == "digitalocean" && values["do_token"] != "":
+			node, err = saveNodeProfile(node, Profile{Token: values["do_token"]})
+		case node.Provider == "gcp" && node.CredentialsFile == "":
+			node.CredentialsFile = values["credentials"]
+		}
+		if err != nil {
+			return Node{}, err
+		}
+
+		scrubbed := terraformCredentialVariables.ReplaceAll(data, nil)
+		scrubbed = terraformCredentialArguments.ReplaceAll(scrubbed, nil)
+		if !bytes.Equal(scrubbed, data) {
+			if err := writeSecret(terraformFile, scrubbed); err != nil {
+				return Node{}, err
+			}
+		}
+	}
+	node.Version = NodeVersion
+	if err := SaveNode(node); err != nil {
+		return Node{}, err
+	}
+
+	return node, nil
+}
+
+// parseTags parses comma separated tags.
+func parseTags(tags string) []string {
+	parsed := []string{}
+	for _, tag := range strings.Split(tags, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" {
+			parsed = append(parsed, tag)
+		}
+	}
+
+	return parsed
+}
+
+// terraformValue returns the value assigned to the key in a terraform config.
+func terraformValue(data []byte, key string) string {
+	match := regexp.MustCompile(key + ` = "(.*)"`).FindSubmatch(data)
+	if match == nil {
+		return ""
+	}
+
+	return string(match[1])
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// validTag matches the tags which can be given to a Darknode. Commas and
+// exclamation marks are reserved for tag selectors.
+var validTag = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:=/-]*$`)
+
+// tagTerm matches a Darknode which has the tag, or which doesn't have the tag
+// if it is negated.
+type tagTerm struct {
+	tag    string
+	negate bool
+}
+
+// TagSelector selects Darknodes by their tags. It matches a Darknode when
+// all terms of any of its clauses match the Darknode.
+type TagSelector [][]tagTerm
+
+// ParseTagSelector parses the selectors given by the user. Multiple selectors
+// are combined with OR, comma separated tags within a selector are combined
+// with AND and a tag prefixed with "!" matches Darknodes without the tag.
+// For example, "region=eu,!canary" selects all Darknodes tagged with
+// "region=eu" which are not tagged with "canary".
+func ParseTagSelector(selectors []string) (TagSelector, error) {
+	selector := TagSelector{}
+	for _, s := range selectors {
+		clause := []tagTerm{}
+		for _, tag := range strings.Split(s, ",") {
+			tag = strings.TrimSpace(tag)
+			term := tagTerm{tag: tag}
+			if strings.HasPrefix(tag, "!") {
+				term = tagTerm{tag: strings.TrimSpace(tag[1:]), negate: true}
+			}
+			if err := validateTag(term.tag); err != nil {
+				return nil, err
+			}
+			clause = append(clause, term)
+		}
+		selector = append(selector, clause)
+	}
+
+	return selector, nil
+}
+
+// Empty returns whether the selector has no clauses.
+func (selector TagSelector) Empty() bool {
+	return len(selector) == 0
+}
+
+// Match returns whether the Darknode is selected. An empty selector matches
+// every Darknode.
+func (selector TagSelector) Match(node Node) bool {
+	if selector.Empty() {
+		return true
+	}
+	for _, clause := range selector {
+		matched := true
+		for _, term := range clause {
+			if node.HasTag(term.tag) == term.negate {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasTag returns whether the Darknode has exactly the given tag.
+func (node Node) HasTag(tag string) bool {
+	return StringInSlice(tag, node.Tags)
+}
+
+// validateTag checks the tag only contains letters, digits and the
+// characters "_.:=/-".
+func validateTag(tag string) error {
+	if !validTag.MatchString(tag) {
+		return fmt.Errorf("%sinvalid tag %q, tags can only contain letters, digits and the characters _.:=/-%s", RED, tag, RESET)
+	}
+
+	return nil
+}
+
+// normalizeTags removes duplicates from the tags and sorts them.
+func normalizeTags(tags []string) []string {
+	set := []string{}
+	for _, tag := range tags {
+		if !StringInSlice(tag, set) {
+			set = append(set, tag)
+		}
+	}
+	sort.Strings(set)
+
+	return set
+}
+
+// selectNodes returns the Darknodes matching the selectors.
+func selectNodes(selectors []string) ([]Node, error) {
+	selector, err := ParseTagSelector(selectors)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := LoadAllNodes()
+	if err != nil {
+		return nil, err
+	}
+	selected := []Node{}
+	for _, node := range nodes {
+		if selector.Match(node) {
+			selected = append(selected, node)
+		}
+	}
+
+	return selected, nil
+}
+
+// selectNodesByNameOrTags returns the Darknode with the given name, or the
+// Darknodes selected by the tags if no name is given.
+func selectNodesByNameOrTags(name string, selectors []string) ([]Node, error) {
+	if name != "" && len(selectors) > 0 {
+		return nil, ErrNameAndTags
+	}
+	if name == "" {
+		return selectNodes(selectors)
+	}
+	node, err := LoadNode(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return []Node{node}, nil
+}
+
+// tagNode adds the tags given as arguments to the Darknode.
+func tagNode(ctx *cli.Context) error {
+	return editTags(ctx, func(node *Node, tags []string) {
+		node.Tags = normalizeTags(append(node.Tags, tags...))
+	})
+}
+
+// untagNode removes the tags given as arguments from the Darknode.
+func untagNode(ctx *cli.Context) error {
+	return editTags(ctx, func(node *Node, tags []string) {
+		remaining := []string{}
+		for _, tag := range node.Tags {
+			if !StringInSlice(tag, tags) {
+				remaining = append(remaining, tag)
+			}
+		}
+		node.Tags = remaining
+	})
+}
+
+// editTags validates the tags given as arguments and applies the edit to the
+// tags of the Darknode.
+func editTags(ctx *cli.Context, edit func(node *Node, tags []string)) error {
+	name := ctx.String("name")
+	tags := ctx.Args()
+	if name == "" {
+		cli.ShowSubcommandHelp(ctx)
+		return ErrEmptyNodeName
+	}
+	if len(tags) == 0 {
+		cli.ShowSubcommandHelp(ctx)
+		return ErrEmptyTags
+	}
+	for _, tag := range tags {
+		if err := validateTag(tag); err != nil {
+			return err
+		}
+	}
+
+	node, err := LoadNode(name)
+	if err != nil {
+		return err
+	}
+	edit(&node, tags)
+	if err := SaveNode(node); err != nil {
+		return err
+	}
+	fmt.Printf("%sTags of [%s]: %s%s\n", GREEN, name, strings.Join(node.Tags, ","), RESET)
+
+	return nil
+}
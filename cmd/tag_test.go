@@ -0,0 +1,152 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTagSelector(t *testing.T) {
+	tests := []struct {
+		selectors []string
+		selector  TagSelector
+		valid     bool
+	}{
+		{[]string{}, TagSelector{}, true},
+		{[]string{"eu"}, TagSelector{{{tag: "eu"}}}, true},
+		{[]string{"region=eu, !canary"}, TagSelector{{{tag: "region=eu"}, {tag: "canary", negate: true}}}, true},
+		{[]string{"eu", "us"}, TagSelector{{{tag: "eu"}}, {{tag: "us"}}}, true},
+		{[]string{"! canary"}, TagSelector{{{tag: "canary", negate: true}}}, true},
+		{[]string{""}, nil, false},
+		{[]string{"eu,"}, nil, false},
+		{[]string{"!"}, nil, false},
+		{[]string{"!!eu"}, nil, false},
+		{[]string{"eu west"}, nil, false},
+		{[]string{"-eu"}, nil, false},
+	}
+	for _, test := range tests {
+		selector, err := ParseTagSelector(test.selectors)
+		if test.valid != (err == nil) {
+			t.Errorf("%q: unexpected error %v", test.selectors, err)
+			continue
+		}
+		if !test.valid {
+			continue
+		}
+		if len(selector) != len(test.selector) {
+			t.Errorf("%q: expected %v, got %v", test.selectors, test.selector, selector)
+			continue
+		}
+		for i := range selector {
+			if len(selector[i]) != len(test.selector[i]) {
+				t.Errorf("%q: expected %v, got %v", test.selectors, test.selector, selector)
+				break
+			}
+			for j := range selector[i] {
+				if selector[i][j] != test.selector[i][j] {
+					t.Errorf("%q: expected %v, got %v", test.selectors, test.selector, selector)
+				}
+			}
+		}
+	}
+}
+
+func TestTagSelectorMatch(t *testing.T) {
+	nodes := map[string]Node{
+		"eu":        {Name: "eu", Tags: []string{"region=eu"}},
+		"eu-canary": {Name: "eu-canary", Tags: []string{"canary", "region=eu"}},
+		"us":        {Name: "us", Tags: []string{"region=us"}},
+		"europe":    {Name: "europe", Tags: []string{"europe-backup"}},
+		"untagged":  {Name: "untagged"},
+	}
+	tests := []struct {
+		selectors []string
+		matched   []string
+	}{
+		{[]string{}, []string{"eu", "eu-canary", "europe", "untagged", "us"}},
+		{[]string{"region=eu"}, []string{"eu", "eu-canary"}},
+		{[]string{"eu"}, []string{}},
+		{[]string{"europe"}, []string{}},
+		{[]string{"region=eu,canary"}, []string{"eu-canary"}},
+		{[]string{"region=eu,!canary"}, []string{"eu"}},
+		{[]string{"region=eu", "region=us"}, []string{"eu", "eu-canary", "us"}},
+		{[]string{"region=us", "canary"}, []string{"eu-canary", "us"}},
+		{[]string{"!region=eu"}, []string{"europe", "untagged", "us"}},
+		{[]string{"!region=eu,!region=us"}, []string{"europe", "untagged"}},
+		{[]string{"canary,!canary"}, []string{}},
+	}
+	for _, test := range tests {
+		selector, err := ParseTagSelector(test.selectors)
+		if err != nil {
+			t.Fatal(err)
+		}
+		matched := []string{}
+		for _, name := range []string{"eu", "eu-canary", "europe", "untagged", "us"} {
+			if selector.Match(nodes[name]) {
+				matched = append(matched, name)
+			}
+		}
+		if strings.Join(matched, " ") != strings.Join(test.matched, " ") {
+			t.Errorf("%q: expected %v, got %v", test.selectors, test.matched, matched)
+		}
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	tests := []struct {
+		tags       []string
+		normalized []string
+	}{
+		{nil, []string{}},
+		{[]string{"b", "a", "b"}, []string{"a", "b"}},
+		{[]string{"region=eu", "canary"}, []string{"canary", "region=eu"}},
+	}
+	for _, test := range tests {
+		normalized := normalizeTags(test.tags)
+		if strings.Join(normalized, ",") != strings.Join(test.normalized, ",") || normalized == nil {
+			t.Errorf("%q: expected %q, got %q", test.tags, test.normalized, normalized)
+		}
+	}
+}
+
+func TestSelectNodesByNameOrTags(t *testing.T) {
+	defer useTempDirectory(t)()
+	for name, tags := range map[string][]string{"node-1": {"eu"}, "node-2": {"us"}, "node-3": {"eu", "canary"}} {
+		writeFakeNode(t, name, "server")
+		node, err := LoadNode(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		node.Tags = tags
+		if err := SaveNode(node); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		selectors []string
+		selected  []string
+		err       error
+	}{
+		{"node-2", nil, []string{"node-2"}, nil},
+		{"", []string{"eu,!canary"}, []string{"node-1"}, nil},
+		{"", []string{"eu", "us"}, []string{"node-1", "node-2", "node-3"}, nil},
+		{"", nil, []string{"node-1", "node-2", "node-3"}, nil},
+		{"node-2", []string{"eu"}, nil, ErrNameAndTags},
+		{"node-4", nil, nil, ErrNoDeploymentFound},
+	}
+	for _, test := range tests {
+		nodes, err := selectNodesByNameOrTags(test.name, test.selectors)
+		if err != test.err {
+			t.Errorf("%q %q: expected %v, got %v", test.name, test.selectors, test.err, err)
+			continue
+		}
+		selected := []string{}
+		for _, node := range nodes {
+			selected = append(selected, node.Name)
+		}
+		if strings.Join(selected, " ") != strings.Join(test.selected, " ") {
+			t.Errorf("%q %q: expected %v, got %v", test.name, test.selectors, test.selected, selected)
+		}
+	}
+}
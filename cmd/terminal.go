@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// Interactive runs the command on the Darknode with the standard input and
+// output of the user attached. An interactive shell is started when the
+// command is empty. A pseudo terminal is requested for the shell, or for the
+// command if tty is true, as long as the standard input is a terminal.
+func (client *SSHClient) Interactive(command string, tty, forwardAgent bool) error {
+	session, err := client.client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	if forwardAgent {
+		socket := os.Getenv("SSH_AUTH_SOCK")
+		if socket == "" {
+			return ErrNoSSHAgent
+		}
+		if err := agent.ForwardToRemote(client.client, socket); err != nil {
+			return err
+		}
+		if err := agent.RequestAgentForwarding(session); err != nil {
+			return err
+		}
+	}
+
+	session.Stdin = os.Stdin
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+
+	fd := int(os.Stdin.Fd())
+	if (command == "" || tty) && terminal.IsTerminal(fd) {
+		state, err := terminal.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer terminal.Restore(fd, state)
+
+		width, height, err := terminal.GetSize(fd)
+		if err != nil {
+			return err
+		}
+		term := os.Getenv("TERM")
+		if term == "" {
+			term = "xterm-256color"
+		}
+		modes := ssh.TerminalModes{
+			ssh.ECHO:          1,
+			ssh.TTY_OP_ISPEED: 14400,
+			ssh.TTY_OP_OSPEED: 14400,
+		}
+		if err := session.RequestPty(term, height, width, modes); err != nil {
+			return err
+		}
+		stop := watchWindowSize(fd, session)
+		defer stop()
+	}
+
+	if command == "" {
+		if err := session.Shell(); err != nil {
+			return err
+		}
+	} else {
+		if err := session.Start(command); err != nil {
+			return err
+		}
+	}
+
+	return client.remoteError(command, session.Wait())
+}
@@ -0,0 +1,41 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// watchWindowSize propagates changes of the terminal size to the session
+// until the returned function is called. Windows has no signal for resizing,
+// so the size is polled instead.
+func watchWindowSize(fd int, session *ssh.Session) func() {
+	done := make(chan struct{})
+	width, height, _ := terminal.GetSize(fd)
+
+	go func() {
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				w, h, err := terminal.GetSize(fd)
+				if err != nil || (w == width && h == height) {
+					continue
+				}
+				width, height = w, h
+				session.WindowChange(height, width)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
@@ -4,153 +4,155 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"math/rand"
 	"os"
 	"os/exec"
-	"strings"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/republicprotocol/republic-go/cmd/darknode/config"
 	"github.com/urfave/cli"
 )
 
-var Providers = []string{"aws", "digitalocean"}
-
 // deployNode deploys node depending on the provider.
 func deployNode(ctx *cli.Context) error {
-	aws := ctx.Bool("aws")
-	digitalOcean := ctx.Bool("digitalocean")
-
-	// Make sure only one provider is provided
-	counter, provider := 0, ""
-	for i, j := range []bool{aws, digitalOcean} {
-		if j {
-			counter++
-			provider = Providers[i]
-		}
+	provider, err := selectedProvider(ctx)
+	if err != nil {
+		return err
 	}
-	if counter == 0 {
-		return ErrNilProvider
-	} else if counter > 1 {
-		return ErrMultipleProviders
+	if _, ok := provider.(CredentialsProvider); !ok && ctx.String("profile") != "" {
+		return ErrNoCredentials
 	}
-
-	switch provider {
-	case "aws":
-		return deployToAWS(ctx)
-	case "digitalocean":
-		return deployToDigitalOcean(ctx)
-	default:
-		return ErrUnknownProvider
+	network, err := LoadNetwork(ctx.String("network"))
+	if err != nil {
+		return err
+	}
+	if err := confirmMainnet(network.Ethereum.Network, "deploy a Darknode"); err != nil {
+		return err
+	}
+	// Ask for the passphrase of the vault before anything is deployed, the
+	// secrets of the new Darknode are locked once it is running.
+	if vaultLocked() {
+		if _, err := unlockVault(); err != nil {
+			return err
+		}
 	}
+
+	return provider.Deploy(ctx)
 }
 
-// deployToAWS parses the AWS credentials and use terraform to deploy the node
-// to AWS.
-func deployToAWS(ctx *cli.Context) error {
-	accessKey := ctx.String("aws-access-key")
-	secretKey := ctx.String("aws-secret-key")
-	network := ctx.String("network")
+// initNode checks the name of the new Darknode and creates its directory. The
+// directory contains the node.json, the config and a new ssh key pair of the
+// Darknode. It returns the directory, the config and the public ssh key.
+func initNode(ctx *cli.Context, provider Provider, region, instance string) (string, config.Config, string, error) {
 	name := ctx.String("name")
 	tags := ctx.String("tags")
+	network := ctx.String("network")
 
-	// Try getting AWS credentials from the input or the default file.
-	if accessKey == "" || secretKey == "" {
-		creds := credentials.NewSharedCredentials("", "default")
-		credValue, err := creds.Get()
-		if err != nil {
-			return err
-		}
-		accessKey, secretKey = credValue.AccessKeyID, credValue.SecretAccessKey
-		if accessKey == "" || secretKey == "" {
-			return ErrKeyNotFound
-		}
-	}
-
-	// Parse region and instance type
-	region, instance, err := parseRegionAndInstance(ctx)
-	if err != nil {
-		return err
-	}
 	// Generate configs for the node
 	config, err := GetConfigOrGenerateNew(ctx)
 	if err != nil {
-		return err
+		return "", config, "", err
 	}
 
-	// Check darknode name and make directory for the node
+	// Check darknode name and tags, and make directory for the node
 	if name == "" {
-		return ErrEmptyNodeName
+		return "", config, "", ErrEmptyNodeName
+	}
+	for _, tag := range parseTags(tags) {
+		if err := validateTag(tag); err != nil {
+			return "", config, "", err
+		}
 	}
-	if _, err := os.Stat(Directory + "/darknodes/" + name); !os.IsNotExist(err) {
-		return ErrNodeExist
+	if _, err := os.Stat(NodeDirectory(name)); !os.IsNotExist(err) {
+		return "", config, "", ErrNodeExist
 	}
-	nodeDirectory := Directory + "/darknodes/" + name
+	nodeDirectory := NodeDirectory(name)
 	if err := os.Mkdir(nodeDirectory, 0777); err != nil {
-		return err
-	}
-	// Store the tags
-	if err := ioutil.WriteFile(nodeDirectory+"/tags.out", []byte(strings.TrimSpace(tags)), 0666); err != nil {
-		return err
+		return "", config, "", err
+	}
+	// Store the metadata of the node
+	node := Node{
+		Name:      name,
+		Provider:  provider.Name(),
+		Region:    region,
+		Instance:  instance,
+		Network:   network,
+		Branch:    NetworkBranch(network),
+		CreatedAt: time.Now().UTC(),
+		Tags:      parseTags(tags),
+		Profile:   ctx.String("profile"),
+	}
+	if err := SaveNode(node); err != nil {
+		return "", config, "", err
 	}
 	// Write the config to file
 	configData, err := json.MarshalIndent(config, "", "    ")
 	if err != nil {
-		return err
+		return "", config, "", err
 	}
 	if err := ioutil.WriteFile(nodeDirectory+"/config.json", configData, 0600); err != nil {
-		return err
+		return "", config, "", err
 	}
 	// Generate new ssk key pair
 	pubKey, err := NewSshKeyPair(nodeDirectory)
 	if err != nil {
 		if err := cleanUp(nodeDirectory); err != nil {
-			return err
-		}
-		return err
-	}
-	if err := generateTerraformConfig(ctx, config, accessKey, secretKey, region, instance, pubKey, nodeDirectory); err != nil {
-		if err := cleanUp(nodeDirectory); err != nil {
-			return err
-		}
-		return err
-	}
-	if err := runTerraform(nodeDirectory); err != nil {
-		if err := cleanUp(nodeDirectory); err != nil {
-			return err
+			return "", config, "", err
 		}
-		return err
+		return "", config, "", err
 	}
 
-	ip, err := getIp(nodeDirectory)
+	return nodeDirectory, config, pubKey, nil
+}
+
+// InstallBranch is the branch of republic-go cloned by the up script when a
+// Darknode is provisioned. It must match target/darknode/scripts/up.sh.
+const InstallBranch = "develop"
+
+// finishDeployment updates the newly deployed Darknode to the branch of its
+// network and shows the user where to register it.
+func finishDeployment(ctx *cli.Context) error {
+	name := ctx.String("name")
+
+	nodeDirectory := NodeDirectory(name)
+	node, err := storeMultiAddress(name)
 	if err != nil {
 		if err := cleanUp(nodeDirectory); err != nil {
 			return err
 		}
 		return err
 	}
+	if err := lockNewNode(name); err != nil {
+		return err
+	}
 
-	// Update node to different branch according to the network.
-	switch network {
-	case "testnet":
-	case "falcon":
-		err = updateSingleNode(name, "develop", false)
-	case "nightly":
-		err = updateSingleNode(name, "nightly", false)
+	// Darknodes are installed from the InstallBranch, so update the node if
+	// its network runs another branch.
+	if node.Branch != InstallBranch {
+		err = updateSingleNode(name, node.Branch, false)
 	}
 
 	fmt.Printf("\n")
 	fmt.Printf("%sCongratulations! Your Darknode is deployed and running%s.\n", GREEN, RESET)
 	fmt.Printf("%sJoin the network by registering your Darknode at%s\n", GREEN, RESET)
-	fmt.Printf("%shttps://darknode.republicprotocol.com/status/%v%s\n", GREEN, ip, RESET)
+	fmt.Printf("%shttps://darknode.republicprotocol.com/status/%v%s\n", GREEN, node.IP, RESET)
+	fmt.Printf("%sor by running `darknode register --name %v --keystore YOUR-ETHEREUM-KEYSTORE`%s\n", GREEN, name, RESET)
 	fmt.Printf("\n")
 	return err
 }
 
-// runTerraform initializes and applies terraform
-func runTerraform(nodeDirectory string) error {
+// runTerraform initializes and applies terraform. The credentials of the cloud
+// provider are passed in the environment. Secrets locked in the vault are
+// decrypted for terraform and removed again afterwards.
+func runTerraform(nodeDirectory string, env []string) error {
+	relock, err := unlockNodeDirectory(nodeDirectory)
+	if err != nil {
+		return err
+	}
+	defer relock()
+
 	cmd := fmt.Sprintf("cd %v && terraform init", nodeDirectory)
 	init := exec.Command("bash", "-c", cmd)
+	init.Env = append(os.Environ(), env...)
 	pipeToStd(init)
 	if err := init.Start(); err != nil {
 		return err
@@ -159,10 +161,11 @@ func runTerraform(nodeDirectory string) error {
 		return err
 	}
 
-	fmt.Printf("%sDeploying dark nodes to AWS%s...\n", GREEN, RESET)
+	fmt.Printf("%sDeploying dark nodes%s...\n", GREEN, RESET)
 
 	cmd = fmt.Sprintf("cd %v && terraform apply -auto-approve", nodeDirectory)
 	apply := exec.Command("bash", "-c", cmd)
+	apply.Env = append(os.Environ(), env...)
 	pipeToStd(apply)
 	if err := apply.Start(); err != nil {
 		return err
@@ -170,57 +173,52 @@ func runTerraform(nodeDirectory string) error {
 	return apply.Wait()
 }
 
-func generateTerraformConfig(ctx *cli.Context, config config.Config, accessKey, secretKey, region, instance, pubKey, nodeDirectory string) error {
-	allocationID := ctx.String("aws-allocation-id")
-
-	allocationConfig, tfFolder := "", "std"
-	if allocationID != "" {
-		allocationConfig = fmt.Sprintf(`allocation_id = "%v"`, allocationID)
-		tfFolder = "eip"
+// storeMultiAddress moves the multiAddress written by the terraform module
+// into the node.json of the newly deployed Darknode.
+func storeMultiAddress(name string) (Node, error) {
+	node, err := LoadNode(name)
+	if err != nil {
+		return node, err
+	}
+	if node.MultiAddress != "" {
+		return node, nil
+	}
+	addressFile := NodeDirectory(name) + "/multiAddress.out"
+	data, err := ioutil.ReadFile(addressFile)
+	if err != nil {
+		return node, err
+	}
+	if err := node.SetMultiAddress(string(data)); err != nil {
+		return node, err
+	}
+	if err := SaveNode(node); err != nil {
+		return node, err
 	}
 
-	terraformConfig := fmt.Sprintf(`
-variable "access_key" {
-	default = "%v"
-}
-
-variable "secret_key" {
-	default = "%v"	
-}
-
-variable "ssh_public_key" {
-	default = "%v"
+	return node, os.Remove(addressFile)
 }
 
-variable "ssh_private_key_location" {
-	default = "%v"
-}
-	`, accessKey, secretKey, strings.TrimSpace(pubKey), nodeDirectory+"/ssh_keypair")
-
-	avz := region + AvailableZones[region][rand.Intn(len(AvailableZones[region]))]
-	mode := fmt.Sprintf(`
-module "node-%v" {
-    source = "%v/instance/%v"
-    ami = "%v"
-    region = "%v"
-    avz = "%v"
-    id = "%v"
-    ec2_instance_type = "%v"
-    ssh_public_key = "${var.ssh_public_key}"
-    ssh_private_key_location = "${var.ssh_private_key_location}"
-    access_key = "${var.access_key}"
-    secret_key = "${var.secret_key}"
-    config = "%v/config.json"
-    port = "%v"
-    path = "%v"
-    %v
-}`, config.Address, Directory, tfFolder, AMIs[region], region, avz, config.Address, instance, nodeDirectory, config.Port, Directory, allocationConfig)
-
-	return ioutil.WriteFile(nodeDirectory+"/main.tf", []byte(terraformConfig+mode), 0600)
-}
+// refreshMultiAddress updates the multiAddress of the node from the output of
+// the terraform module.
+func refreshMultiAddress(name string) error {
+	node, err := LoadNode(name)
+	if err != nil {
+		return err
+	}
+	address, err := node.Address()
+	if err != nil {
+		return err
+	}
+	cmd := fmt.Sprintf("cd %v && terraform output -module=node-%v multiaddress", NodeDirectory(name), address)
+	output := exec.Command("bash", "-c", cmd)
+	output.Stderr = os.Stderr
+	data, err := output.Output()
+	if err != nil {
+		return err
+	}
+	if err := node.SetMultiAddress(string(data)); err != nil {
+		return err
+	}
 
-// deployToDigitalOcean parses the digital ocean credentials and use terraform
-// to deploy the node to digital ocean.
-func deployToDigitalOcean(ctx *cli.Context) error {
-	panic("unimplemented")
+	return SaveNode(node)
 }
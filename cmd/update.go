@@ -2,8 +2,7 @@ package main
 
 import (
 	"fmt"
-	"io/ioutil"
-	"os/exec"
+	"strings"
 
 	"github.com/republicprotocol/republic-go/dispatch"
 	"github.com/urfave/cli"
@@ -13,11 +12,11 @@ import (
 // This will restart the Darknode.
 func updateNode(ctx *cli.Context) error {
 	name := ctx.String("name")
-	tag := ctx.String("tag")
+	tags := ctx.StringSlice("tag")
 	branch := ctx.String("branch")
 	updateConfig := ctx.Bool("config")
 
-	if name == "" && tag == "" {
+	if name == "" && len(tags) == 0 {
 		cli.ShowCommandHelp(ctx, "update")
 		return ErrEmptyNodeName
 	}
@@ -28,18 +27,18 @@ func updateNode(ctx *cli.Context) error {
 			return err
 		}
 	}
-	// Update a set of nodes by the tag
-	if tag != "" {
-		nodeNames, err := getNodesByTag(tag)
+	// Update a set of nodes by the tags
+	if len(tags) != 0 {
+		nodes, err := selectNodes(tags)
 		if err != nil {
 			return err
 		}
-		if len(nodeNames) == 0 {
+		if len(nodes) == 0 {
 			return ErrNoNodesFound
 		}
-		errs := make(chan error, len(nodeNames))
-		dispatch.CoForAll(nodeNames, func(i int) {
-			err := updateSingleNode(nodeNames[i], branch, updateConfig)
+		errs := make(chan error, len(nodes))
+		dispatch.CoForAll(nodes, func(i int) {
+			err := updateSingleNode(nodes[i].Name, branch, updateConfig)
 			if err != nil {
 				errs <- err
 			}
@@ -54,29 +53,17 @@ func updateNode(ctx *cli.Context) error {
 }
 
 func updateSingleNode(name, branch string, updateConfig bool) error {
-	nodeDirectory := Directory + "/darknodes/" + name
-	keyPairPath := nodeDirectory + "/ssh_keypair"
-	ip, err := getIp(nodeDirectory)
+	client, err := DialNode(name)
 	if err != nil {
 		return err
 	}
+	defer client.Close()
 
 	// Check if we need to update the node config
 	if updateConfig {
-		data, err := ioutil.ReadFile(nodeDirectory + "/config.json")
-		if err != nil {
-			return err
-		}
-		updateConfigScript := fmt.Sprintf(`echo '%s' > $HOME/.darknode/config.json`, string(data))
-		updateConfigCmd := exec.Command("ssh", "-i", keyPairPath, "ubuntu@"+ip, "-oStrictHostKeyChecking=no", updateConfigScript)
-		pipeToStd(updateConfigCmd)
-		if err := updateConfigCmd.Start(); err != nil {
+		if err := pushConfig(client, name); err != nil {
 			return err
 		}
-		if err := updateConfigCmd.Wait(); err != nil {
-			return err
-		}
-		fmt.Printf("%sConfig of [%s] has been updated to the local version.%s\n", GREEN, name, RESET)
 	}
 
 	updateScript := fmt.Sprintf(`
@@ -92,13 +79,15 @@ go install
 cd
 sudo service darknode restart
 `, branch, branch, branch)
-
-	updateCmd := exec.Command("ssh", "-i", keyPairPath, "ubuntu@"+ip, "-oStrictHostKeyChecking=no", updateScript)
-	pipeToStd(updateCmd)
-	if err := updateCmd.Start(); err != nil {
+	if err := client.Run(updateScript); err != nil {
 		return err
 	}
-	if err := updateCmd.Wait(); err != nil {
+	node, err := LoadNode(name)
+	if err != nil {
+		return err
+	}
+	node.Branch = branch
+	if err := SaveNode(node); err != nil {
 		return err
 	}
 	fmt.Printf("%s[%s] has been updated to the latest version on %s branch.%s \n", GREEN, name, branch, RESET)
@@ -106,24 +95,21 @@ sudo service darknode restart
 	return nil
 }
 
-// sshNode will ssh into the Darknode
+// sshNode opens an interactive shell on the Darknode, or runs the command
+// given after the flags.
 func sshNode(ctx *cli.Context) error {
 	name := ctx.String("name")
+	tty := ctx.Bool("tty")
+	forwardAgent := ctx.Bool("forward-agent")
 	if name == "" {
 		cli.ShowCommandHelp(ctx, "ssh")
 		return ErrEmptyNodeName
 	}
-	nodeDirectory := Directory + "/darknodes/" + name
-	ip, err := getIp(nodeDirectory)
+	client, err := DialNode(name)
 	if err != nil {
 		return err
 	}
-	keyPairPath := nodeDirectory + "/ssh_keypair"
-	ssh := exec.Command("ssh", "-i", keyPairPath, "ubuntu@"+ip)
-	pipeToStd(ssh)
-	if err := ssh.Start(); err != nil {
-		return err
-	}
+	defer client.Close()
 
-	return ssh.Wait()
+	return client.Interactive(strings.Join(ctx.Args(), " "), tty, forwardAgent)
 }
@@ -0,0 +1,656 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/republicprotocol/republic-go/cmd/darknode/config"
+	"github.com/republicprotocol/republic-go/crypto"
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/scrypt"
+)
+
+// VaultSuffix is appended to the names of the secrets encrypted by the vault.
+const VaultSuffix = ".vault"
+
+// VaultPassphraseFileEnv is the environment variable with the path of a file
+// containing the passphrase of the vault, for running the CLI from scripts.
+const VaultPassphraseFileEnv = "DARKNODE_VAULT_PASSPHRASE_FILE"
+
+// vaultCheck is encrypted into the vault file to check the passphrase.
+const vaultCheck = "darknode vault"
+
+// vaultMagic is the header of the encrypted secrets.
+var vaultMagic = []byte("DNV1")
+
+// nodeSecrets are the files in the directory of a Darknode which are
+// encrypted by the vault. The config contains the keystore of the Darknode,
+// main.tf can contain the credentials of the cloud provider and user_data.yml
+// contains the private host key of the Darknode.
+var nodeSecrets = []string{"config.json", "ssh_keypair", "main.tf", "user_data.yml"}
+
+// Vault contains the parameters for deriving the key of the vault from the
+// master passphrase. The secrets are encrypted with AES-256-GCM using the
+// key, which is derived with scrypt like crypto.Keystore does.
+type Vault struct {
+	Version int    `json:"version"`
+	N       int    `json:"n"`
+	R       int    `json:"r"`
+	P       int    `json:"p"`
+	Salt    []byte `json:"salt"`
+	Check   []byte `json:"check"`
+}
+
+// vaultKey caches the key of the vault, so the passphrase is asked for at
+// most once, even when Darknodes are handled concurrently.
+var vaultKey struct {
+	sync.Mutex
+	key []byte
+}
+
+// VaultFile returns the path of the vault file. The vault is locked while the
+// file exists.
+func VaultFile() string {
+	return Directory + "/vault.json"
+}
+
+// vaultLocked returns whether the secrets of the Darknodes are encrypted.
+func vaultLocked() bool {
+	_, err := os.Stat(VaultFile())
+	return err == nil
+}
+
+// readSecret reads the secret file, decrypting it if it is locked in the
+// vault. Other files are read as they are.
+func readSecret(path string) ([]byte, error) {
+	if err := checkSecret(path); err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err == nil || !os.IsNotExist(err) {
+		return data, err
+	}
+	encrypted, vaultErr := ioutil.ReadFile(path + VaultSuffix)
+	if vaultErr != nil {
+		return nil, err
+	}
+	key, err := unlockVault()
+	if err != nil {
+		return nil, err
+	}
+
+	return decryptSecret(key, encrypted)
+}
+
+// writeSecret writes the secret file, encrypting it if it is locked in the
+// vault.
+func writeSecret(path string, data []byte) error {
+	if err := checkSecret(path); err != nil {
+		return err
+	}
+	if _, err := os.Stat(path + VaultSuffix); err != nil {
+		return ioutil.WriteFile(path, data, 0600)
+	}
+	key, err := unlockVault()
+	if err != nil {
+		return err
+	}
+	encrypted, err := encryptSecret(key, data)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path+VaultSuffix, encrypted)
+}
+
+// checkSecret returns an error if the secret exists both in plaintext and
+// locked in the vault. This happens when the CLI is killed while the secret
+// is decrypted for terraform, and neither file can be trusted to be the
+// latest one.
+func checkSecret(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	if _, err := os.Stat(path + VaultSuffix); err != nil {
+		return nil
+	}
+
+	return fmt.Errorf("%s%v is locked in the vault but also exists in plaintext, remove the plaintext file if it was left behind by an interrupted command%s", RED, path, RESET)
+}
+
+// loadConfig reads the config of the Darknode with the given name.
+func loadConfig(name string) (config.Config, error) {
+	data, err := readSecret(NodeDirectory(name) + "/config.json")
+	if err != nil {
+		return config.Config{}, err
+	}
+	cfg := config.Config{}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return config.Config{}, err
+	}
+
+	return cfg, nil
+}
+
+// unlockNodeDirectory decrypts the locked secrets of the Darknode into the
+// node directory for tools like terraform which read them from disk. The
+// returned function removes the decrypted files again. If the CLI is
+// interrupted or terminated before, the decrypted files are removed and the
+// CLI exits.
+func unlockNodeDirectory(nodeDirectory string) (func(), error) {
+	var mu sync.Mutex
+	unlocked, relocked := []string{}, false
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	relock := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if relocked {
+			return
+		}
+		relocked = true
+		signal.Stop(signals)
+		close(done)
+		for _, path := range unlocked {
+			os.Remove(path)
+		}
+	}
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+			relock()
+			fmt.Fprintf(os.Stderr, "%sinterrupted, the decrypted secrets of %v have been removed%s\n", RED, nodeDirectory, RESET)
+			os.Exit(1)
+		case <-done:
+		}
+	}()
+
+	for _, secret := range nodeSecrets {
+		path := nodeDirectory + "/" + secret
+		if _, err := os.Stat(path + VaultSuffix); err != nil {
+			continue
+		}
+		data, err := readSecret(path)
+		if err != nil {
+			relock()
+			return nil, err
+		}
+		mu.Lock()
+		if !relocked {
+			if err = ioutil.WriteFile(path, data, 0600); err == nil {
+				unlocked = append(unlocked, path)
+			}
+		}
+		mu.Unlock()
+		if err != nil {
+			relock()
+			return nil, err
+		}
+	}
+
+	return relock, nil
+}
+
+// lockSecrets encrypts the plaintext secret files and removes the plaintext
+// files. Missing files are skipped.
+func lockSecrets(paths []string, key []byte) error {
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		encrypted, err := encryptSecret(key, data)
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(path+VaultSuffix, encrypted); err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unlockSecrets decrypts the locked secret files into plaintext files and
+// removes the encrypted files. Missing files are skipped.
+func unlockSecrets(paths []string, key []byte) error {
+	for _, path := range paths {
+		encrypted, err := ioutil.ReadFile(path + VaultSuffix)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		data, err := decryptSecret(key, encrypted)
+		if err != nil {
+			return fmt.Errorf("%scannot decrypt %v: %v%s", RED, path, err, RESET)
+		}
+		if err := writeFileAtomic(path, data); err != nil {
+			return err
+		}
+		if err := os.Remove(path + VaultSuffix); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lockNewNode encrypts the secrets of a newly deployed Darknode if the vault
+// is locked.
+func lockNewNode(name string) error {
+	if !vaultLocked() {
+		return nil
+	}
+	key, err := unlockVault()
+	if err != nil {
+		return err
+	}
+
+	return lockSecrets(nodeSecretPaths(NodeDirectory(name)), key)
+}
+
+// lockNewSecret encrypts a newly written secret file outside of the
+// directories of the Darknodes if the vault is locked.
+func lockNewSecret(path string) error {
+	if !vaultLocked() {
+		return nil
+	}
+	key, err := unlockVault()
+	if err != nil {
+		return err
+	}
+
+	return lockSecrets([]string{path}, key)
+}
+
+// unlockVault returns the key of the vault, asking for the passphrase the
+// first time.
+func unlockVault() ([]byte, error) {
+	vaultKey.Lock()
+	defer vaultKey.Unlock()
+	if vaultKey.key != nil {
+		return vaultKey.key, nil
+	}
+
+	vault, err := readVault()
+	if err != nil {
+		return nil, err
+	}
+	passphrase, err := vaultPassphrase("Passphrase of the vault: ")
+	if err != nil {
+		return nil, err
+	}
+	key, err := vault.Key(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	vaultKey.key = key
+
+	return key, nil
+}
+
+// vaultPassphrase reads the passphrase of the vault from the file in the
+// environment, or asks the user for it.
+func vaultPassphrase(prompt string) (string, error) {
+	if passphraseFile := os.Getenv(VaultPassphraseFileEnv); passphraseFile != "" {
+		data, err := ioutil.ReadFile(passphraseFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	return readPassphrase(prompt)
+}
+
+// newVaultPassphrase reads the new passphrase of the vault from the
+// --passphrase-file flag, or asks the user for it twice.
+func newVaultPassphrase(ctx *cli.Context) (string, error) {
+	passphrase, err := flagPassphrase(ctx)
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		passphrase, err = readPassphrase("New passphrase of the vault: ")
+		if err != nil {
+			return "", err
+		}
+		confirmation, err := readPassphrase("Repeat the passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if passphrase != confirmation {
+			return "", ErrPassphraseMismatch
+		}
+	}
+	if passphrase == "" {
+		return "", ErrEmptyPassphrase
+	}
+
+	return passphrase, nil
+}
+
+// newVault creates the parameters of a vault for the passphrase, and returns
+// them with the key of the vault.
+func newVault(passphrase string) (Vault, []byte, error) {
+	vault := Vault{
+		Version: 1,
+		N:       crypto.StandardScryptN,
+		R:       8,
+		P:       crypto.StandardScryptP,
+		Salt:    make([]byte, 32),
+	}
+	if _, err := io.ReadFull(rand.Reader, vault.Salt); err != nil {
+		return Vault{}, nil, err
+	}
+	key, err := scrypt.Key([]byte(passphrase), vault.Salt, vault.N, vault.R, vault.P, 32)
+	if err != nil {
+		return Vault{}, nil, err
+	}
+	vault.Check, err = encryptSecret(key, []byte(vaultCheck))
+	if err != nil {
+		return Vault{}, nil, err
+	}
+
+	return vault, key, nil
+}
+
+// Key derives the key of the vault from the passphrase and checks it.
+func (vault Vault) Key(passphrase string) ([]byte, error) {
+	key, err := scrypt.Key([]byte(passphrase), vault.Salt, vault.N, vault.R, vault.P, 32)
+	if err != nil {
+		return nil, err
+	}
+	check, err := decryptSecret(key, vault.Check)
+	if err != nil || string(check) != vaultCheck {
+		return nil, ErrWrongVaultPassphrase
+	}
+
+	return key, nil
+}
+
+// readVault reads the parameters of the vault.
+func readVault() (Vault, error) {
+	data, err := ioutil.ReadFile(VaultFile())
+	if os.IsNotExist(err) {
+		return Vault{}, ErrVaultNotLocked
+	}
+	if err != nil {
+		return Vault{}, err
+	}
+	vault := Vault{}
+	if err := json.Unmarshal(data, &vault); err != nil {
+		return Vault{}, err
+	}
+
+	return vault, nil
+}
+
+// writeVault writes the parameters of the vault.
+func writeVault(vault Vault) error {
+	data, err := json.MarshalIndent(vault, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(VaultFile(), data)
+}
+
+// encryptSecret encrypts the data with AES-256-GCM under the key.
+func encryptSecret(key, data []byte) ([]byte, error) {
+	gcm, err := newVaultCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	encrypted := append(append([]byte{}, vaultMagic...), nonce...)
+
+	return gcm.Seal(encrypted, nonce, data, vaultMagic), nil
+}
+
+// decryptSecret decrypts the data encrypted by encryptSecret.
+func decryptSecret(key, encrypted []byte) ([]byte, error) {
+	gcm, err := newVaultCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(encrypted, vaultMagic) || len(encrypted) < len(vaultMagic)+gcm.NonceSize() {
+		return nil, errors.New("not encrypted by the vault")
+	}
+	nonce := encrypted[len(vaultMagic) : len(vaultMagic)+gcm.NonceSize()]
+
+	return gcm.Open(nil, nonce, encrypted[len(vaultMagic)+gcm.NonceSize():], vaultMagic)
+}
+
+func newVaultCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// writeFileAtomic writes the data to a temporary file readable only by the
+// owner and renames it over the path.
+func writeFileAtomic(path string, data []byte) error {
+	if err := ioutil.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+// nodeSecretPaths returns the paths of the secrets in the directory of a
+// Darknode.
+func nodeSecretPaths(nodeDirectory string) []string {
+	paths := make([]string, len(nodeSecrets))
+	for i, secret := range nodeSecrets {
+		paths[i] = nodeDirectory + "/" + secret
+	}
+
+	return paths
+}
+
+// vaultSecrets returns the paths of all secrets managed by the vault, which
+// are the credential profiles and the secrets of all Darknodes. It also
+// returns the number of Darknodes.
+func vaultSecrets() ([]string, int, error) {
+	directories, err := nodeDirectories()
+	if err != nil {
+		return nil, 0, err
+	}
+	paths := []string{ProfilesFile()}
+	for _, directory := range directories {
+		paths = append(paths, nodeSecretPaths(directory)...)
+	}
+
+	return paths, len(directories), nil
+}
+
+// nodeDirectories returns the directories of all Darknodes.
+func nodeDirectories() ([]string, error) {
+	files, err := ioutil.ReadDir(Directory + "/darknodes")
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	directories := []string{}
+	for _, f := range files {
+		if f.IsDir() {
+			directories = append(directories, NodeDirectory(f.Name()))
+		}
+	}
+
+	return directories, nil
+}
+
+// lockVault encrypts the secrets of all Darknodes and the credential profiles.
+// The vault is created with a new passphrase the first time.
+func lockVault(ctx *cli.Context) error {
+	var key []byte
+	if vaultLocked() {
+		var err error
+		key, err = unlockVault()
+		if err != nil {
+			return err
+		}
+	} else {
+		passphrase, err := newVaultPassphrase(ctx)
+		if err != nil {
+			return err
+		}
+		vault, newKey, err := newVault(passphrase)
+		if err != nil {
+			return err
+		}
+		if err := writeVault(vault); err != nil {
+			return err
+		}
+		key = newKey
+	}
+
+	secrets, nodes, err := vaultSecrets()
+	if err != nil {
+		return err
+	}
+	if err := lockSecrets(secrets, key); err != nil {
+		return err
+	}
+	fmt.Printf("%sThe secrets of %d Darknodes are locked in the vault.%s\n", GREEN, nodes, RESET)
+
+	return nil
+}
+
+// unlockVaultFiles decrypts the secrets of all Darknodes back into plaintext
+// files and removes the vault.
+func unlockVaultFiles(ctx *cli.Context) error {
+	key, err := unlockVault()
+	if err != nil {
+		return err
+	}
+	secrets, nodes, err := vaultSecrets()
+	if err != nil {
+		return err
+	}
+	if err := unlockSecrets(secrets, key); err != nil {
+		return err
+	}
+	if err := os.Remove(VaultFile()); err != nil {
+		return err
+	}
+	fmt.Printf("%sThe secrets of %d Darknodes have been decrypted and the vault has been removed.%s\n", GREEN, nodes, RESET)
+
+	return nil
+}
+
+// rotateVault re-encrypts the secrets of all Darknodes with a new passphrase.
+// All secrets are re-encrypted into temporary files before any of them
+// replaces its old version, and the vault file is only replaced once all of
+// them have been replaced. If anything fails, the old secrets are restored and
+// the old passphrase stays valid.
+func rotateVault(ctx *cli.Context) error {
+	key, err := unlockVault()
+	if err != nil {
+		return err
+	}
+	passphrase, err := newVaultPassphrase(ctx)
+	if err != nil {
+		return err
+	}
+	vault, newKey, err := newVault(passphrase)
+	if err != nil {
+		return err
+	}
+
+	secrets, _, err := vaultSecrets()
+	if err != nil {
+		return err
+	}
+	paths, old := []string{}, map[string][]byte{}
+	removeTemporary := func() {
+		for _, path := range paths {
+			os.Remove(path + ".tmp")
+		}
+	}
+	for _, secret := range secrets {
+		path := secret + VaultSuffix
+		encrypted, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			removeTemporary()
+			return err
+		}
+		data, err := decryptSecret(key, encrypted)
+		if err != nil {
+			removeTemporary()
+			return fmt.Errorf("%scannot decrypt %v: %v%s", RED, path, err, RESET)
+		}
+		old[path] = encrypted
+		if encrypted, err = encryptSecret(newKey, data); err != nil {
+			removeTemporary()
+			return err
+		}
+		paths = append(paths, path)
+		if err := ioutil.WriteFile(path+".tmp", encrypted, 0600); err != nil {
+			removeTemporary()
+			return err
+		}
+	}
+
+	// Restore the secrets encrypted with the old key if the rotation cannot
+	// be finished.
+	rotated := 0
+	restore := func(err error) error {
+		for _, path := range paths[:rotated] {
+			if restoreErr := writeFileAtomic(path, old[path]); restoreErr != nil {
+				return fmt.Errorf("%scannot restore %v: %v, the secret is encrypted with the new passphrase%s", RED, path, restoreErr, RESET)
+			}
+		}
+		removeTemporary()
+		return err
+	}
+	for _, path := range paths {
+		if err := os.Rename(path+".tmp", path); err != nil {
+			return restore(err)
+		}
+		rotated++
+	}
+	if err := writeVault(vault); err != nil {
+		return restore(err)
+	}
+	vaultKey.Lock()
+	vaultKey.key = newKey
+	vaultKey.Unlock()
+	fmt.Printf("%sThe passphrase of the vault has been changed.%s\n", GREEN, RESET)
+
+	return nil
+}
@@ -0,0 +1,152 @@
+variable "region" {}
+variable "droplet_size" {}
+variable "id" {}
+variable "config" {}
+variable "ssh_public_key" {}
+variable "ssh_private_key_location" {}
+variable "port" {}
+variable "path" {}
+
+// The cloud-init config installing the host key generated by the CLI, and the
+// public host key verified by the provisioners. Both are empty for Darknodes
+// deployed by older versions of the CLI.
+variable "user_data" {
+  default = ""
+}
+variable "host_key" {
+  default = ""
+}
+
+provider "digitalocean" {
+  alias = "darknode"
+}
+
+resource "digitalocean_ssh_key" "darknode" {
+  provider   = "digitalocean.darknode"
+  name       = "darknode-kp-${var.id}"
+  public_key = "${var.ssh_public_key}"
+}
+
+output "multiaddress" {
+  value = "/ip4/${digitalocean_droplet.darknode.ipv4_address}/tcp/18514/republic/${var.id}"
+}
+
+resource "digitalocean_droplet" "darknode" {
+  provider   = "digitalocean.darknode"
+  image      = "ubuntu-16-04-x64"
+  name       = "darknode-${lower(var.id)}"
+  region     = "${var.region}"
+  size       = "${var.droplet_size}"
+  monitoring = true
+  ssh_keys   = ["${digitalocean_ssh_key.darknode.id}"]
+  user_data  = "${var.user_data}"
+
+  // Droplets only have a root user, so we create the ubuntu user expected
+  // by the provisioning scripts and the Darknode CLI.
+  provisioner "remote-exec" {
+    inline = [
+      "adduser --disabled-password --gecos '' ubuntu",
+      "echo 'ubuntu ALL=(ALL) NOPASSWD:ALL' > /etc/sudoers.d/ubuntu",
+      "mkdir -p /home/ubuntu/.ssh",
+      "cp /root/.ssh/authorized_keys /home/ubuntu/.ssh/authorized_keys",
+      "chown -R ubuntu:ubuntu /home/ubuntu/.ssh",
+    ]
+
+    connection {
+      type        = "ssh"
+      user        = "root"
+      private_key = "${file("${var.ssh_private_key_location}")}"
+      host_key    = "${var.host_key}"
+    }
+  }
+
+  provisioner "file" {
+    source      = "${var.config}"
+    destination = "/home/ubuntu/darknode-config.json"
+
+    connection {
+      type        = "ssh"
+      user        = "ubuntu"
+      private_key = "${file("${var.ssh_private_key_location}")}"
+      host_key    = "${var.host_key}"
+    }
+  }
+
+  provisioner "file" {
+    source      = "${var.path}/provisions"
+    destination = "/home/ubuntu/provisions"
+
+    connection {
+      type        = "ssh"
+      user        = "ubuntu"
+      private_key = "${file("${var.ssh_private_key_location}")}"
+      host_key    = "${var.host_key}"
+    }
+  }
+
+  provisioner "remote-exec" {
+    script = "${var.path}/scripts/up.sh"
+
+    connection {
+      type        = "ssh"
+      user        = "ubuntu"
+      private_key = "${file("${var.ssh_private_key_location}")}"
+      host_key    = "${var.host_key}"
+    }
+  }
+
+  provisioner "local-exec" {
+      command = "echo /ip4/${digitalocean_droplet.darknode.ipv4_address}/tcp/${var.port}/republic/${var.id} > multiAddress.out"
+  }
+}
+
+resource "digitalocean_firewall" "darknode" {
+  provider    = "digitalocean.darknode"
+  name        = "darknode-fw-${lower(var.id)}"
+  droplet_ids = ["${digitalocean_droplet.darknode.id}"]
+
+  // SSH
+  inbound_rule {
+    protocol         = "tcp"
+    port_range       = "22"
+    source_addresses = ["0.0.0.0/0", "::/0"]
+  }
+
+  // Logstash
+  inbound_rule {
+    protocol         = "tcp"
+    port_range       = "9200"
+    source_addresses = ["0.0.0.0/0", "::/0"]
+  }
+
+  // Kibana
+  inbound_rule {
+    protocol         = "tcp"
+    port_range       = "5601"
+    source_addresses = ["0.0.0.0/0", "::/0"]
+  }
+
+  // Republic Protocol
+  inbound_rule {
+    protocol         = "tcp"
+    port_range       = "18514-18515"
+    source_addresses = ["0.0.0.0/0", "::/0"]
+  }
+
+  outbound_rule {
+    protocol              = "tcp"
+    port_range            = "1-65535"
+    destination_addresses = ["0.0.0.0/0", "::/0"]
+  }
+
+  outbound_rule {
+    protocol              = "udp"
+    port_range            = "1-65535"
+    destination_addresses = ["0.0.0.0/0", "::/0"]
+  }
+
+  outbound_rule {
+    protocol              = "icmp"
+    destination_addresses = ["0.0.0.0/0", "::/0"]
+  }
+}
@@ -7,17 +7,23 @@ variable "config" {}
 variable "ec2_instance_type" {}
 variable "ssh_public_key" {}
 variable "ssh_private_key_location" {}
-variable "access_key" {}
-variable "secret_key" {}
 variable "port" {}
 variable "path" {}
+
+// The cloud-init config installing the host key generated by the CLI, and the
+// public host key verified by the provisioners. Both are empty for Darknodes
+// deployed by older versions of the CLI.
+variable "user_data" {
+  default = ""
+}
+variable "host_key" {
+  default = ""
+}
 variable "allocation_id" {}
 
 provider "aws" {
-  alias      = "falcon0"
-  access_key = "${var.access_key}"
-  secret_key = "${var.secret_key}"
-  region     = "${var.region}"
+  alias  = "falcon0"
+  region = "${var.region}"
 }
 
 resource "aws_security_group" "falcon0" {
@@ -91,6 +97,7 @@ resource "aws_instance" "falcon0" {
   instance_type   = "${var.ec2_instance_type}"
   key_name        = "${aws_key_pair.falcon0.key_name}"
   security_groups = ["${aws_security_group.falcon0.name}"]
+  user_data       = "${var.user_data}"
   availability_zone =  "${var.avz}"
 
   provisioner "file" {
@@ -101,6 +108,7 @@ resource "aws_instance" "falcon0" {
       type        = "ssh"
       user        = "ubuntu"
       private_key = "${file("${var.ssh_private_key_location}")}"
+      host_key    = "${var.host_key}"
     }
   }
 
@@ -112,6 +120,7 @@ resource "aws_instance" "falcon0" {
       type        = "ssh"
       user        = "ubuntu"
       private_key = "${file("${var.ssh_private_key_location}")}"
+      host_key    = "${var.host_key}"
     }
   }
 
@@ -122,6 +131,7 @@ resource "aws_instance" "falcon0" {
       type        = "ssh"
       user        = "ubuntu"
       private_key = "${file("${var.ssh_private_key_location}")}"
+      host_key    = "${var.host_key}"
     }
   }
 }
@@ -0,0 +1,114 @@
+variable "project" {}
+variable "region" {}
+variable "zone" {}
+variable "machine_type" {}
+variable "id" {}
+variable "config" {}
+variable "ssh_public_key" {}
+variable "ssh_private_key_location" {}
+variable "port" {}
+variable "path" {}
+
+// The cloud-init config installing the host key generated by the CLI, and the
+// public host key verified by the provisioners. Both are empty for Darknodes
+// deployed by older versions of the CLI.
+variable "user_data" {
+  default = ""
+}
+variable "host_key" {
+  default = ""
+}
+
+provider "google" {
+  alias   = "darknode"
+  project = "${var.project}"
+  region  = "${var.region}"
+}
+
+resource "google_compute_firewall" "darknode" {
+  provider    = "google.darknode"
+  name        = "darknode-fw-${lower(var.id)}"
+  network     = "default"
+  description = "Allow inbound SSH ,Republic Protocol traffic and logstash/kibana"
+
+  // SSH, Logstash, Kibana and Republic Protocol
+  allow {
+    protocol = "tcp"
+    ports    = ["22", "9200", "5601", "18514-18515"]
+  }
+
+  source_ranges = ["0.0.0.0/0"]
+  target_tags   = ["darknode-${lower(var.id)}"]
+}
+
+output "multiaddress" {
+  value = "/ip4/${google_compute_instance.darknode.network_interface.0.access_config.0.nat_ip}/tcp/18514/republic/${var.id}"
+}
+
+resource "google_compute_instance" "darknode" {
+  provider                  = "google.darknode"
+  name                      = "darknode-${lower(var.id)}"
+  machine_type              = "${var.machine_type}"
+  zone                      = "${var.zone}"
+  tags                      = ["darknode-${lower(var.id)}"]
+  allow_stopping_for_update = true
+
+  boot_disk {
+    initialize_params {
+      image = "ubuntu-os-cloud/ubuntu-1604-lts"
+      size  = 20
+    }
+  }
+
+  network_interface {
+    network       = "default"
+    access_config = {}
+  }
+
+  metadata {
+    ssh-keys  = "ubuntu:${var.ssh_public_key}"
+    user-data = "${var.user_data}"
+  }
+
+  provisioner "file" {
+    source      = "${var.config}"
+    destination = "/home/ubuntu/darknode-config.json"
+
+    connection {
+      type        = "ssh"
+      host        = "${self.network_interface.0.access_config.0.nat_ip}"
+      user        = "ubuntu"
+      private_key = "${file("${var.ssh_private_key_location}")}"
+      host_key    = "${var.host_key}"
+    }
+  }
+
+  provisioner "file" {
+    source      = "${var.path}/provisions"
+    destination = "/home/ubuntu/provisions"
+
+    connection {
+      type        = "ssh"
+      host        = "${self.network_interface.0.access_config.0.nat_ip}"
+      user        = "ubuntu"
+      private_key = "${file("${var.ssh_private_key_location}")}"
+      host_key    = "${var.host_key}"
+    }
+  }
+
+  provisioner "remote-exec" {
+    script = "${var.path}/scripts/up.sh"
+
+    connection {
+      type        = "ssh"
+      host        = "${self.network_interface.0.access_config.0.nat_ip}"
+      user        = "ubuntu"
+      private_key = "${file("${var.ssh_private_key_location}")}"
+      host_key    = "${var.host_key}"
+    }
+  }
+
+  provisioner "local-exec" {
+      command = "echo /ip4/${self.network_interface.0.access_config.0.nat_ip}/tcp/${var.port}/republic/${var.id} > multiAddress.out"
+  }
+}
@@ -7,16 +7,22 @@ variable "config" {}
 variable "ec2_instance_type" {}
 variable "ssh_public_key" {}
 variable "ssh_private_key_location" {}
-variable "access_key" {}
-variable "secret_key" {}
 variable "port" {}
 variable "path" {}
 
+// The cloud-init config installing the host key generated by the CLI, and the
+// public host key verified by the provisioners. Both are empty for Darknodes
+// deployed by older versions of the CLI.
+variable "user_data" {
+  default = ""
+}
+variable "host_key" {
+  default = ""
+}
+
 provider "aws" {
-  alias      = "darknode"
-  access_key = "${var.access_key}"
-  secret_key = "${var.secret_key}"
-  region     = "${var.region}"
+  alias  = "darknode"
+  region = "${var.region}"
 }
 
 resource "aws_security_group" "darknode" {
@@ -79,6 +85,7 @@ resource "aws_instance" "darknode" {
   instance_type   = "${var.ec2_instance_type}"
   key_name        = "${aws_key_pair.darknode.key_name}"
   security_groups = ["${aws_security_group.darknode.name}"]
+  user_data       = "${var.user_data}"
 
   provisioner "file" {
     source      = "${var.config}"
@@ -88,6 +95,7 @@ resource "aws_instance" "darknode" {
       type        = "ssh"
       user        = "ubuntu"
       private_key = "${file("${var.ssh_private_key_location}")}"
+      host_key    = "${var.host_key}"
     }
   }
 
@@ -99,6 +107,7 @@ resource "aws_instance" "darknode" {
       type        = "ssh"
       user        = "ubuntu"
       private_key = "${file("${var.ssh_private_key_location}")}"
+      host_key    = "${var.host_key}"
     }
   }
 
@@ -109,6 +118,7 @@ resource "aws_instance" "darknode" {
       type        = "ssh"
       user        = "ubuntu"
       private_key = "${file("${var.ssh_private_key_location}")}"
+      host_key    = "${var.host_key}"
     }
   }
 
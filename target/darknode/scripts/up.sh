@@ -13,10 +13,11 @@ sudo mv ./provisions/logstash.service /etc/systemd/system/logstash.service
 
 # Install golang
 wget https://dl.google.com/go/go1.10.linux-amd64.tar.gz
+sudo rm -rf /usr/local/go
 sudo tar -C /usr/local -xzf go1.10.linux-amd64.tar.gz
 rm go1.10.linux-amd64.tar.gz
-echo "export PATH=$PATH:/usr/local/go/bin" >> $HOME/.profile
-sudo ln -s /usr/local/go/bin/go /usr/bin/go
+grep -q ":/usr/local/go/bin$" $HOME/.profile || echo "export PATH=$PATH:/usr/local/go/bin" >> $HOME/.profile
+sudo ln -sf /usr/local/go/bin/go /usr/bin/go
 
 # Install logstash
 wget https://artifacts.elastic.co/downloads/logstash/logstash-6.2.2.tar.gz
@@ -26,7 +27,7 @@ until sudo apt install -y default-jre; do sleep 2; done
 mv ./provisions/logstash.conf ./logstash-6.2.2/darknode.conf
 
 # Configure darknode and the updater
-mkdir ./.darknode/
+mkdir -p ./.darknode/
 mv ./darknode-config.json ./.darknode/config.json
 mv ./scripts/updater.sh ./.darknode/updater.sh
 
@@ -45,10 +46,11 @@ export GOBIN=$HOME/go/bin
 export GOPATH=$HOME/go
 curl https://raw.githubusercontent.com/golang/dep/master/install.sh | sh
 
-# Install darknode
+# Install darknode, the branch must match InstallBranch in cmd/up.go
 until sudo apt install -y gcc; do sleep 2; done
 mkdir -p ./go/src/github.com/republicprotocol
 cd ./go/src/github.com/republicprotocol
+rm -rf republic-go
 git clone -b develop https://github.com/republicprotocol/republic-go.git
 cd republic-go/cmd/darknode
 $GOBIN/dep ensure